@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type (
+	genQuery struct {
+		Name    string
+		Var     string
+		Literal string
+		Kind    string
+		Params  []genField
+		Columns []genField
+	}
+
+	genField struct {
+		Name   string
+		Column string
+		Type   string
+	}
+)
+
+var (
+	initialisms = map[string]bool{
+		"id": true, "ids": true, "url": true, "uri": true, "uuid": true, "json": true,
+		"api": true, "http": true, "sql": true, "ip": true, "db": true, "html": true,
+	}
+
+	fileTemplate = template.Must(template.New("file").Parse(`// Code generated by yagen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+{{range .Queries}}
+const {{.Var}}SQL = {{.Literal}}
+{{if .Columns}}
+type {{.Name}}Row struct {
+{{- range .Columns}}
+	{{.Name}} {{.Type}} ` + "`" + `db:"{{.Column}}"` + "`" + `
+{{- end}}
+}
+
+var {{.Var}}Stmt = db.NewStmtFactory[{{.Name}}Row]({{.Var}}SQL)
+{{end}}
+func {{.Name}}(ctx context.Context, executor db.Executor{{range .Params}}, {{.Name}} {{.Type}}{{end}}) (
+{{- if eq .Kind ":exec"}}pgconn.CommandTag{{else if eq .Kind ":one"}}{{.Name}}Row{{else}}[]{{.Name}}Row{{end}}, error) {
+{{- if eq .Kind ":exec"}}
+	return db.Exec(ctx, executor, {{.Var}}SQL{{range .Params}}, {{.Name}}{{end}})
+{{- else if eq .Kind ":one"}}
+	return {{.Var}}Stmt.ScanOne(ctx, executor{{range .Params}}, {{.Name}}{{end}})
+{{- else}}
+	return {{.Var}}Stmt.Scan(ctx, executor{{range .Params}}, {{.Name}}{{end}})
+{{- end}}
+}
+{{end}}`))
+)
+
+func generate(pkg string, qs []query) ([]byte, error) {
+	imports := []string{"context", "github.com/bomjdev/yetanother/db"}
+	var gqs []genQuery
+	for _, q := range qs {
+		gq, err := genQueryOf(q)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", q.Name, err)
+		}
+		if gq.Kind == ":exec" {
+			imports = append(imports, "github.com/jackc/pgx/v5/pgconn")
+		}
+		for _, c := range slices.Concat(q.Params, q.Columns) {
+			if c.Type.Import != "" {
+				imports = append(imports, c.Type.Import)
+			}
+		}
+		gqs = append(gqs, gq)
+	}
+	slices.Sort(imports)
+
+	var b bytes.Buffer
+	if err := fileTemplate.Execute(&b, map[string]any{
+		"Package": pkg,
+		"Imports": slices.Compact(imports),
+		"Queries": gqs,
+	}); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format: %w\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
+
+func genQueryOf(q query) (genQuery, error) {
+	name := goName(q.Name)
+	gq := genQuery{
+		Name:    name,
+		Var:     lowerFirst(name),
+		Literal: literal(q.SQL),
+		Kind:    q.Kind,
+	}
+	switch gq.Kind {
+	case ":one", ":many", ":exec":
+	case "":
+		gq.Kind = ":many"
+		if len(q.Columns) == 0 {
+			gq.Kind = ":exec"
+		}
+	default:
+		return genQuery{}, fmt.Errorf("unknown kind %q", q.Kind)
+	}
+	if gq.Kind != ":exec" && len(q.Columns) == 0 {
+		return genQuery{}, fmt.Errorf("%s statement returns no columns", gq.Kind)
+	}
+
+	// Suffixed, the package-level names are neither keywords nor
+	// predeclared identifiers; params must not shadow them.
+	used := map[string]bool{"ctx": true, "executor": true, gq.Var + "SQL": true, gq.Var + "Stmt": true}
+	for _, p := range q.Params {
+		arg := lowerFirst(goName(p.Name))
+		if used[arg] || token.IsKeyword(arg) {
+			arg += "Arg"
+		}
+		used[arg] = true
+		gq.Params = append(gq.Params, genField{Name: arg, Type: p.Type.Name})
+	}
+
+	fields := make(map[string]bool)
+	for _, c := range q.Columns {
+		field := goName(c.Name)
+		if fields[field] {
+			return genQuery{}, fmt.Errorf("duplicate column %q", c.Name)
+		}
+		fields[field] = true
+		gq.Columns = append(gq.Columns, genField{Name: field, Column: c.Name, Type: c.Type.Name})
+	}
+	return gq, nil
+}
+
+// goName converts snake_case or camelCase to an exported Go identifier,
+// upper-casing common initialisms.
+func goName(s string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if initialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	if b.Len() == 0 || unicode.IsDigit(rune(b.String()[0])) {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	runes := []rune(s)
+	n := 1
+	for n < len(runes) && unicode.IsUpper(runes[n]) && (n+1 == len(runes) || unicode.IsUpper(runes[n+1])) {
+		n++
+	}
+	for i := range n {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+func literal(sql string) string {
+	if strings.Contains(sql, "`") {
+		return strconv.Quote(sql)
+	}
+	return "`" + sql + "`"
+}
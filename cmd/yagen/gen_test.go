@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/bomjdev/yetanother/db"
+	"strings"
+	"testing"
+)
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"user_id":    "UserID",
+		"GetUser":    "GetUser",
+		"created_at": "CreatedAt",
+		"api_url":    "APIURL",
+		"?column?":   "Column",
+		"1st":        "X1st",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	for in, want := range map[string]string{"GetUser": "getUser", "ID": "id", "IDByName": "idByName"} {
+		if got := lowerFirst(in); got != want {
+			t.Errorf("lowerFirst(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	src, err := generate("queries", []query{
+		{
+			NamedStmt: db.NamedStmt{Name: "GetUser", Kind: ":one", SQL: "SELECT id, name, created_at FROM users WHERE id = $1"},
+			Params:    []column{{Name: "id", Type: builtinOIDs[20]}},
+			Columns: []column{
+				{Name: "id", Type: builtinOIDs[20]},
+				{Name: "name", Type: goType{Name: "*string"}},
+				{Name: "created_at", Type: timeType},
+			},
+		},
+		{
+			NamedStmt: db.NamedStmt{Name: "Type", SQL: "SELECT typname FROM pg_type WHERE typname = $1"},
+			Params:    []column{{Name: "type_stmt", Type: goType{Name: "string"}}},
+			Columns:   []column{{Name: "typname", Type: goType{Name: "string"}}},
+		},
+		{
+			NamedStmt: db.NamedStmt{Name: "RenameUser", SQL: "UPDATE users SET name = $1 WHERE id = $2"},
+			Params:    []column{{Name: "name", Type: goType{Name: "string"}}, {Name: "type", Type: goType{Name: "string"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// Code generated by yagen. DO NOT EDIT.",
+		`"time"`,
+		`"github.com/jackc/pgx/v5/pgconn"`,
+		"const getUserSQL = `SELECT id, name, created_at FROM users WHERE id = $1`",
+		"\tName      *string   `db:\"name\"`",
+		"var getUserStmt = db.NewStmtFactory[GetUserRow](getUserSQL)",
+		"func GetUser(ctx context.Context, executor db.Executor, id int64) (GetUserRow, error) {\n\treturn getUserStmt.ScanOne(ctx, executor, id)",
+		"var typeStmt = db.NewStmtFactory[TypeRow](typeSQL)",
+		"func Type(ctx context.Context, executor db.Executor, typeStmtArg string) ([]TypeRow, error) {\n\treturn typeStmt.Scan(ctx, executor, typeStmtArg)",
+		"func RenameUser(ctx context.Context, executor db.Executor, name string, typeArg string) (pgconn.CommandTag, error) {\n\treturn db.Exec(ctx, executor, renameUserSQL, name, typeArg)",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code misses %q:\n%s", want, src)
+		}
+	}
+
+	if _, err = generate("queries", []query{{NamedStmt: db.NamedStmt{Name: "Bad", Kind: ":one", SQL: "DELETE FROM t"}}}); err == nil {
+		t.Error(":one without columns not reported")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type (
+	goType struct {
+		Name    string
+		Import  string
+		Nilable bool
+	}
+
+	column struct {
+		Name string
+		Type goType
+	}
+
+	query struct {
+		db.NamedStmt
+		Params  []column
+		Columns []column
+	}
+
+	conn interface {
+		db.Preparer
+		db.Executor
+	}
+
+	inferrer struct {
+		conn  conn
+		types map[uint32]goType
+	}
+)
+
+var (
+	timeType    = goType{Name: "time.Time", Import: "time"}
+	bytesType   = goType{Name: "[]byte", Nilable: true}
+	builtinOIDs = map[uint32]goType{
+		pgtype.BoolOID:        {Name: "bool"},
+		pgtype.Int2OID:        {Name: "int16"},
+		pgtype.Int4OID:        {Name: "int32"},
+		pgtype.Int8OID:        {Name: "int64"},
+		pgtype.OIDOID:         {Name: "uint32"},
+		pgtype.Float4OID:      {Name: "float32"},
+		pgtype.Float8OID:      {Name: "float64"},
+		pgtype.TextOID:        {Name: "string"},
+		pgtype.VarcharOID:     {Name: "string"},
+		pgtype.BPCharOID:      {Name: "string"},
+		pgtype.NameOID:        {Name: "string"},
+		pgtype.ByteaOID:       bytesType,
+		pgtype.JSONOID:        bytesType,
+		pgtype.JSONBOID:       bytesType,
+		pgtype.DateOID:        timeType,
+		pgtype.TimestampOID:   timeType,
+		pgtype.TimestamptzOID: timeType,
+		pgtype.IntervalOID:    {Name: "pgtype.Interval", Import: "github.com/jackc/pgx/v5/pgtype"},
+		pgtype.UUIDOID:        {Name: "uuid.UUID", Import: "github.com/gofrs/uuid/v5"},
+		pgtype.NumericOID:     {Name: "decimal.Decimal", Import: "github.com/shopspring/decimal"},
+		pgtype.InetOID:        {Name: "netip.Prefix", Import: "net/netip"},
+		pgtype.CIDROID:        {Name: "netip.Prefix", Import: "net/netip"},
+	}
+)
+
+func newInferrer(conn conn) *inferrer {
+	return &inferrer{conn: conn, types: make(map[uint32]goType)}
+}
+
+func (i *inferrer) infer(ctx context.Context, stmt db.NamedStmt) (query, error) {
+	sd, err := i.conn.Prepare(ctx, "", stmt.SQL)
+	if err != nil {
+		return query{}, fmt.Errorf("prepare: %w", err)
+	}
+	q := query{NamedStmt: stmt}
+	for n, oid := range sd.ParamOIDs {
+		name := fmt.Sprintf("arg%d", n+1)
+		if n < len(stmt.Params) {
+			name = stmt.Params[n]
+		}
+		t, err := i.resolve(ctx, oid)
+		if err != nil {
+			return query{}, fmt.Errorf("parameter %q: %w", name, err)
+		}
+		q.Params = append(q.Params, column{Name: name, Type: t})
+	}
+	for _, f := range sd.Fields {
+		t, err := i.resolve(ctx, f.DataTypeOID)
+		if err != nil {
+			return query{}, fmt.Errorf("column %q: %w", f.Name, err)
+		}
+		notNull := false
+		if f.TableOID != 0 {
+			if err = i.conn.QueryRow(ctx,
+				"SELECT attnotnull FROM pg_attribute WHERE attrelid = $1 AND attnum = $2",
+				f.TableOID, f.TableAttributeNumber,
+			).Scan(&notNull); err != nil {
+				return query{}, fmt.Errorf("column %q nullability: %w", f.Name, err)
+			}
+		}
+		if !notNull && !t.Nilable {
+			t.Name = "*" + t.Name
+		}
+		q.Columns = append(q.Columns, column{Name: f.Name, Type: t})
+	}
+	return q, nil
+}
+
+// resolve maps a type OID to a Go type: builtins directly, domains through
+// their base type, enums to string and arrays to slices of their element.
+// Anything else scans into any.
+func (i *inferrer) resolve(ctx context.Context, oid uint32) (goType, error) {
+	if t, ok := builtinOIDs[oid]; ok {
+		return t, nil
+	}
+	if t, ok := i.types[oid]; ok {
+		return t, nil
+	}
+	var (
+		typtype, category string
+		elem, base        uint32
+	)
+	if err := i.conn.QueryRow(ctx,
+		"SELECT typtype::text, typcategory::text, typelem, typbasetype FROM pg_type WHERE oid = $1", oid,
+	).Scan(&typtype, &category, &elem, &base); err != nil {
+		return goType{}, fmt.Errorf("type %d: %w", oid, err)
+	}
+	t := goType{Name: "any", Nilable: true}
+	switch {
+	case typtype == "d":
+		var err error
+		if t, err = i.resolve(ctx, base); err != nil {
+			return goType{}, err
+		}
+	case typtype == "e":
+		t = goType{Name: "string"}
+	case category == "A" && elem != 0:
+		et, err := i.resolve(ctx, elem)
+		if err != nil {
+			return goType{}, err
+		}
+		t = goType{Name: "[]" + et.Name, Import: et.Import, Nilable: true}
+	}
+	i.types[oid] = t
+	return t, nil
+}
@@ -0,0 +1,86 @@
+// Command yagen generates typed query functions from annotated SQL files.
+//
+// Every "-- name: X [:one|:many|:exec]" statement is prepared against a live
+// database to infer parameter and column types; columns of table attributes
+// take their nullability from pg_attribute, computed columns are nullable.
+// With -schema the schema file is applied first inside a transaction that is
+// rolled back, so an empty database is enough.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+func main() {
+	var (
+		queries = flag.String("queries", "queries/*.sql", "glob of annotated SQL files")
+		dsn     = flag.String("dsn", os.Getenv("DATABASE_URL"), "database connection string")
+		schema  = flag.String("schema", "", "schema file applied in a rolled back transaction before inference")
+		pkg     = flag.String("package", "queries", "package name of the generated file")
+		out     = flag.String("out", "queries.gen.go", "output file")
+	)
+	flag.Parse()
+	if err := run(context.Background(), *queries, *dsn, *schema, *pkg, *out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, pattern, dsn, schema, pkg, out string) error {
+	statements, err := db.LoadStatements(os.DirFS(filepath.Dir(pattern)), filepath.Base(pattern))
+	if err != nil {
+		return fmt.Errorf("load statements: %w", err)
+	}
+	if len(statements) == 0 {
+		return fmt.Errorf("no statements in %s", pattern)
+	}
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer func() {
+		_ = conn.Close(ctx)
+	}()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if schema != "" {
+		text, err := os.ReadFile(schema)
+		if err != nil {
+			return fmt.Errorf("read schema: %w", err)
+		}
+		if _, err = tx.Exec(ctx, string(text)); err != nil {
+			return fmt.Errorf("apply schema: %w", err)
+		}
+	}
+
+	inferrer := newInferrer(tx)
+	var qs []query
+	for _, name := range slices.Sorted(maps.Keys(statements)) {
+		q, err := inferrer.infer(ctx, statements[name])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", statements[name].File, name, err)
+		}
+		qs = append(qs, q)
+	}
+
+	src, err := generate(pkg, qs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type (
+	BatchSender interface {
+		SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	}
+
+	Batch struct {
+		queued  []batchStmt
+		results []batchResult
+	}
+
+	// batchStmt is a queued statement, built when the batch is sent so that
+	// builders get the scope of the send context.
+	batchStmt struct {
+		stmt    string
+		args    []any
+		builder squirrel.Sqlizer
+		fn      func(br pgx.BatchResults) error
+	}
+
+	BatchResult[T any] struct {
+		value T
+		err   error
+		done  bool
+	}
+
+	BatchStmtFunc[T any] func(b *Batch, args ...any) *BatchResult[T]
+
+	batchResult interface {
+		resolved() bool
+		fail(err error)
+	}
+)
+
+var ErrBatchNotSent = errors.New("batch not sent")
+
+func NewBatch() *Batch {
+	return new(Batch)
+}
+
+func (b *Batch) Len() int {
+	return len(b.queued)
+}
+
+func BatchQuery[T any](b *Batch, scan ScanFunc[T], stmt string, args ...any) *BatchResult[T] {
+	r := new(BatchResult[T])
+	b.results = append(b.results, r)
+	b.queued = append(b.queued, batchStmt{stmt: stmt, args: args, fn: batchQuery(r, scan)})
+	return r
+}
+
+func batchQuery[T any](r *BatchResult[T], scan ScanFunc[T]) func(br pgx.BatchResults) error {
+	return func(br pgx.BatchResults) error {
+		rows, err := br.Query()
+		if err != nil {
+			r.resolve(r.value, ClassifyError(err))
+			return nil
+		}
+		r.resolve(scan(rows))
+		return nil
+	}
+}
+
+func BatchExec(b *Batch, stmt string, args ...any) *BatchResult[pgconn.CommandTag] {
+	r := new(BatchResult[pgconn.CommandTag])
+	b.results = append(b.results, r)
+	b.queued = append(b.queued, batchStmt{stmt: stmt, args: args, fn: func(br pgx.BatchResults) error {
+		tag, err := br.Exec()
+		r.resolve(tag, ClassifyError(err))
+		return nil
+	}})
+	return r
+}
+
+// BatchBuilder queues builder, restricted to the scope of the send context
+// as WithBuilder does.
+func BatchBuilder[T any](b *Batch, scan ScanFunc[T], builder squirrel.Sqlizer) *BatchResult[T] {
+	r := new(BatchResult[T])
+	if _, _, err := builder.ToSql(); err != nil {
+		r.resolve(r.value, err)
+		return r
+	}
+	b.results = append(b.results, r)
+	b.queued = append(b.queued, batchStmt{builder: builder, fn: batchQuery(r, scan)})
+	return r
+}
+
+func NewBatchStmt[T any](stmt string, scan ScanFunc[T]) BatchStmtFunc[T] {
+	return func(b *Batch, args ...any) *BatchResult[T] {
+		return BatchQuery(b, scan, stmt, args...)
+	}
+}
+
+// Send sends the queued statements. Under a scope nothing is sent when a
+// statement cannot be scoped, raw ones included, see Scope.
+func (b *Batch) Send(ctx context.Context, sender BatchSender) error {
+	batch, err := b.build(ctx)
+	if err == nil {
+		err = sender.SendBatch(ctx, batch).Close()
+	}
+	for _, r := range b.results {
+		if r.resolved() {
+			continue
+		}
+		if err != nil {
+			r.fail(ClassifyError(err))
+		} else {
+			r.fail(ErrBatchNotSent)
+		}
+	}
+	return ClassifyError(err)
+}
+
+func (b *Batch) build(ctx context.Context) (*pgx.Batch, error) {
+	scope := ScopeFrom(ctx)
+	batch := new(pgx.Batch)
+	for _, q := range b.queued {
+		stmt, args := q.stmt, q.args
+		if q.builder == nil {
+			if err := checkScope(ctx); err != nil {
+				return nil, err
+			}
+		} else {
+			scoped, err := scope.Apply(q.builder)
+			if err != nil {
+				return nil, err
+			}
+			if stmt, args, err = scoped.ToSql(); err != nil {
+				return nil, err
+			}
+		}
+		batch.Queue(stmt, args...).Fn = q.fn
+	}
+	return batch, nil
+}
+
+// SendContext sends the batch on the executor carried by ctx when it can send
+// batches, on fallback otherwise.
+func (b *Batch) SendContext(ctx context.Context, fallback BatchSender) error {
+	if sender, ok := ExecutorFrom(ctx, nil).(BatchSender); ok {
+		return b.Send(ctx, sender)
+	}
+	return b.Send(ctx, fallback)
+}
+
+// SendBatch sends b in the transaction carried by ctx, or on the primary pool:
+// a batch may hold writes, so it is never routed to a replica.
+func (p PGX) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if tx, ok := p.txFrom(ctx); ok {
+		return tx.SendBatch(ctx, b)
+	}
+	markWrite(ctx)
+	return p.pool.SendBatch(ctx, b)
+}
+
+func (r *BatchResult[T]) Value() (T, error) {
+	if !r.done {
+		return r.value, ErrBatchNotSent
+	}
+	return r.value, r.err
+}
+
+func (r *BatchResult[T]) resolve(value T, err error) {
+	r.value, r.err, r.done = value, err, true
+}
+
+func (r *BatchResult[T]) resolved() bool {
+	return r.done
+}
+
+func (r *BatchResult[T]) fail(err error) {
+	var zero T
+	r.resolve(zero, err)
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+type (
+	batchReply struct {
+		rows *fakeRows
+		tag  pgconn.CommandTag
+		err  error
+	}
+
+	// fakeBatchSender answers queued statements in order with replies, the
+	// way pgx runs each queued callback on Close.
+	fakeBatchSender struct {
+		replies []batchReply
+		err     error
+		sent    []string
+	}
+
+	fakeBatchResults struct {
+		sender *fakeBatchSender
+		batch  *pgx.Batch
+		reply  batchReply
+	}
+)
+
+func (s *fakeBatchSender) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	return &fakeBatchResults{sender: s, batch: b}
+}
+
+func (r *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	return r.reply.tag, r.reply.err
+}
+
+func (r *fakeBatchResults) Query() (pgx.Rows, error) {
+	if r.reply.rows == nil {
+		return &fakeRows{}, r.reply.err
+	}
+	return r.reply.rows, r.reply.err
+}
+
+func (r *fakeBatchResults) QueryRow() pgx.Row {
+	rows, err := r.Query()
+	return fakeQueryRow{rows: rows, err: err}
+}
+
+func (r *fakeBatchResults) Close() error {
+	for i, qq := range r.batch.QueuedQueries {
+		if r.sender.err != nil && i >= len(r.sender.replies) {
+			return r.sender.err
+		}
+		r.sender.sent = append(r.sender.sent, qq.SQL)
+		r.reply = r.sender.replies[i]
+		if err := qq.Fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *fakeTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return (&fakeBatchSender{replies: make([]batchReply, b.Len())}).SendBatch(ctx, b)
+}
+
+func TestBatch(t *testing.T) {
+	b := NewBatch()
+	names := BatchQuery(b, ScanWith(MapScalar[string]), "SELECT name FROM users WHERE id = ANY($1)", []int{1, 2})
+	deleted := BatchExec(b, "DELETE FROM sessions WHERE user_id = $1", 1)
+	count := BatchBuilder(b, ScanExactlyOneWith(MapScalar[int64]), Postgres.Select("count(*)").From("users"))
+	byID := NewBatchStmt("SELECT name FROM users WHERE id = $1", ScanExactlyOneWith(MapScalar[string]))(b, 3)
+	missing := NewBatchStmt("SELECT name FROM users WHERE id = $1", ScanExactlyOneWith(MapScalar[string]))(b, 4)
+
+	if _, err := names.Value(); !errors.Is(err, ErrBatchNotSent) {
+		t.Errorf("value before send: %v", err)
+	}
+	sender := &fakeBatchSender{replies: []batchReply{
+		{rows: newFakeRows([]string{"name"}, []any{"a"}, []any{"b"})},
+		{tag: pgconn.NewCommandTag("DELETE 2")},
+		{rows: newFakeRows([]string{"count"}, []any{int64(2)})},
+		{rows: newFakeRows([]string{"name"}, []any{"c"})},
+		{rows: newFakeRows([]string{"name"})},
+	}}
+	if err := b.Send(context.Background(), sender); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 5 || sender.sent[2] != "SELECT count(*) FROM users" {
+		t.Errorf("sent %q", sender.sent)
+	}
+	if v, err := names.Value(); err != nil || len(v) != 2 || v[1] != "b" {
+		t.Errorf("names = %v, %v", v, err)
+	}
+	if tag, err := deleted.Value(); err != nil || tag.RowsAffected() != 2 {
+		t.Errorf("deleted = %v, %v", tag, err)
+	}
+	if n, err := count.Value(); err != nil || n != 2 {
+		t.Errorf("count = %d, %v", n, err)
+	}
+	if name, err := byID.Value(); err != nil || name != "c" {
+		t.Errorf("byID = %q, %v", name, err)
+	}
+	if _, err := missing.Value(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing row: %v", err)
+	}
+}
+
+func TestBatchSendError(t *testing.T) {
+	errConn := errors.New("connection reset")
+	b := NewBatch()
+	first := BatchExec(b, "UPDATE users SET name = $1", "a")
+	second := BatchExec(b, "UPDATE users SET name = $1", "b")
+	sender := &fakeBatchSender{replies: []batchReply{{tag: pgconn.NewCommandTag("UPDATE 1")}}, err: errConn}
+	if err := b.Send(context.Background(), sender); !errors.Is(err, errConn) {
+		t.Fatalf("send error = %v", err)
+	}
+	if _, err := first.Value(); err != nil {
+		t.Errorf("first = %v", err)
+	}
+	if _, err := second.Value(); !errors.Is(err, errConn) {
+		t.Errorf("second = %v, want %v", err, errConn)
+	}
+
+	builder := BatchBuilder(b, ScanWith(MapScalar[int]), Postgres.Select())
+	if _, err := builder.Value(); err == nil {
+		t.Error("invalid builder resolved without error")
+	}
+}
+
+func TestBatchSendContext(t *testing.T) {
+	tx := &fakeTx{}
+	fallback := &fakeBatchSender{}
+	b := NewBatch()
+	result := BatchExec(b, "DELETE FROM sessions")
+	if err := b.SendContext(WithExecutor(context.Background(), tx), fallback); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := result.Value(); err != nil || len(fallback.sent) != 0 {
+		t.Errorf("batch not sent in the context transaction: %v, fallback sent %q", err, fallback.sent)
+	}
+
+	b = NewBatch()
+	result = BatchExec(b, "DELETE FROM sessions")
+	if err := b.Send(WithExecutor(context.Background(), tx), PGX{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := result.Value(); err != nil {
+		t.Errorf("PGX.SendBatch did not use the context transaction: %v", err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 var Postgres = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
+// BuildQuery does not apply the scope: use Scope.BuildQuery for statements
+// run under one.
 func BuildQuery(query query.Query, builder squirrel.SelectBuilder) (string, []any, error) {
 	b, err := buildQuery(query, builder)
 	if err != nil {
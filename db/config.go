@@ -0,0 +1,266 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	Config struct {
+		Credentials        `yaml:",inline"`
+		Hosts              []Host        `yaml:"hosts"`
+		TargetSessionAttrs string        `yaml:"target_session_attrs"`
+		ApplicationName    string        `yaml:"application_name"`
+		SearchPath         string        `yaml:"search_path"`
+		StatementTimeout   time.Duration `yaml:"statement_timeout"`
+		ConnectTimeout     time.Duration `yaml:"connect_timeout"`
+		TLS                TLSConfig     `yaml:"tls"`
+		Pool               PoolConfig    `yaml:"pool"`
+	}
+
+	Host struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+
+	TLSConfig struct {
+		CAFile     string `yaml:"ca_file"`
+		CertFile   string `yaml:"cert_file"`
+		KeyFile    string `yaml:"key_file"`
+		ServerName string `yaml:"server_name"`
+	}
+
+	PoolConfig struct {
+		MinConns              int32         `yaml:"min_conns"`
+		MaxConns              int32         `yaml:"max_conns"`
+		MaxConnLifetime       time.Duration `yaml:"max_conn_lifetime"`
+		MaxConnLifetimeJitter time.Duration `yaml:"max_conn_lifetime_jitter"`
+		MaxConnIdleTime       time.Duration `yaml:"max_conn_idle_time"`
+		HealthCheckPeriod     time.Duration `yaml:"health_check_period"`
+	}
+)
+
+const defaultPort = 5432
+
+// PoolConfig builds the pool configuration from c alone. Every setting that
+// pgconn would otherwise take from PG* environment variables or a passfile is
+// pinned, except PGSERVICE and PGSERVICEFILE: a service cannot be cleared from
+// a connection string, so those still apply.
+func (c Config) PoolConfig() (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(c.connString())
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	cc := cfg.ConnConfig
+	cc.ConnectTimeout = c.ConnectTimeout
+	cc.RuntimeParams = make(map[string]string)
+
+	var hosts []Host
+	if c.Host != "" {
+		hosts = append(hosts, Host{Host: c.Host, Port: c.Port})
+	}
+	hosts = append(hosts, c.Hosts...)
+	if len(hosts) == 0 {
+		return nil, errors.New("no host configured")
+	}
+	var fallbacks []*pgconn.FallbackConfig
+	for _, host := range hosts {
+		if host.Host == "" {
+			return nil, errors.New("host without a name")
+		}
+		if host.Port == 0 {
+			host.Port = defaultPort
+		}
+		if host.Port < 1 || host.Port > 65535 {
+			return nil, fmt.Errorf("host %q: port %d out of range", host.Host, host.Port)
+		}
+		tlsConfigs, err := c.tlsConfigs(host.Host)
+		if err != nil {
+			return nil, fmt.Errorf("tls %q: %w", host.Host, err)
+		}
+		for _, tlsConfig := range tlsConfigs {
+			fallbacks = append(fallbacks, &pgconn.FallbackConfig{
+				Host:      host.Host,
+				Port:      uint16(host.Port),
+				TLSConfig: tlsConfig,
+			})
+		}
+	}
+	cc.Host, cc.Port, cc.TLSConfig = fallbacks[0].Host, fallbacks[0].Port, fallbacks[0].TLSConfig
+	cc.Fallbacks = fallbacks[1:]
+
+	if cc.ValidateConnect, err = validateConnect(c.TargetSessionAttrs); err != nil {
+		return nil, err
+	}
+
+	if c.ApplicationName != "" {
+		cc.RuntimeParams["application_name"] = c.ApplicationName
+	}
+	if c.SearchPath != "" {
+		cc.RuntimeParams["search_path"] = c.SearchPath
+	}
+	if c.StatementTimeout > 0 {
+		cc.RuntimeParams["statement_timeout"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if c.Pool.MinConns > 0 {
+		cfg.MinConns = c.Pool.MinConns
+	}
+	if c.Pool.MaxConns > 0 {
+		cfg.MaxConns = c.Pool.MaxConns
+	}
+	if c.Pool.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = c.Pool.MaxConnLifetime
+	}
+	if c.Pool.MaxConnLifetimeJitter > 0 {
+		cfg.MaxConnLifetimeJitter = c.Pool.MaxConnLifetimeJitter
+	}
+	if c.Pool.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = c.Pool.MaxConnIdleTime
+	}
+	if c.Pool.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = c.Pool.HealthCheckPeriod
+	}
+
+	return cfg, nil
+}
+
+// connString pins the settings pgconn reads from the environment. Host, port
+// and TLS are placeholders replaced per host by PoolConfig.
+func (c Config) connString() string {
+	settings := []struct{ key, value string }{
+		{"host", "localhost"},
+		{"port", strconv.Itoa(defaultPort)},
+		{"dbname", c.Database},
+		{"user", c.User},
+		{"password", c.Password},
+		{"passfile", ""},
+		{"connect_timeout", strconv.FormatInt(int64((c.ConnectTimeout+time.Second-1)/time.Second), 10)},
+		{"sslmode", "disable"},
+		{"sslrootcert", ""},
+		{"sslcert", ""},
+		{"sslkey", ""},
+		{"sslpassword", ""},
+		{"target_session_attrs", "any"},
+	}
+	parts := make([]string, len(settings))
+	for i, s := range settings {
+		parts[i] = s.key + "=" + quoteSetting(s.value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteSetting(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func validateConnect(attrs string) (pgconn.ValidateConnectFunc, error) {
+	switch attrs {
+	case "", "any":
+		return nil, nil
+	case "read-write":
+		return pgconn.ValidateConnectTargetSessionAttrsReadWrite, nil
+	case "read-only":
+		return pgconn.ValidateConnectTargetSessionAttrsReadOnly, nil
+	case "primary":
+		return pgconn.ValidateConnectTargetSessionAttrsPrimary, nil
+	case "standby":
+		return pgconn.ValidateConnectTargetSessionAttrsStandby, nil
+	case "prefer-standby":
+		return pgconn.ValidateConnectTargetSessionAttrsPreferStandby, nil
+	default:
+		return nil, fmt.Errorf("unknown target_session_attrs %q", attrs)
+	}
+}
+
+// tlsConfigs returns the TLS configurations to try in order for host,
+// following libpq sslmode semantics; nil means a plaintext connection.
+func (c Config) tlsConfigs(host string) ([]*tls.Config, error) {
+	mode := c.SSLMode
+	if mode == "" {
+		mode = "prefer"
+	}
+	if mode == "disable" {
+		return []*tls.Config{nil}, nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: host}
+	if c.TLS.ServerName != "" {
+		tlsConfig.ServerName = c.TLS.ServerName
+	}
+
+	if c.TLS.CertFile != "" || c.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load key pair: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if c.TLS.CAFile != "" {
+		pem, err := os.ReadFile(c.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in ca file")
+		}
+	}
+
+	switch mode {
+	case "allow", "prefer", "require":
+		tlsConfig.InsecureSkipVerify = true
+		if roots != nil && mode == "require" {
+			tlsConfig.VerifyPeerCertificate = verifyChain(roots)
+		}
+	case "verify-ca":
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChain(roots)
+	case "verify-full":
+		tlsConfig.RootCAs = roots
+	default:
+		return nil, fmt.Errorf("unknown sslmode %q", mode)
+	}
+
+	switch mode {
+	case "allow":
+		return []*tls.Config{nil, tlsConfig}, nil
+	case "prefer":
+		return []*tls.Config{tlsConfig, nil}, nil
+	default:
+		return []*tls.Config{tlsConfig}, nil
+	}
+}
+
+func verifyChain(roots *x509.CertPool) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parse certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
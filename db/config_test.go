@@ -0,0 +1,125 @@
+package db
+
+import (
+	"github.com/bomjdev/yetanother/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	cfg, err := config.ReadConfig[Config](strings.NewReader(`
+host: db1
+user: app
+password: "p@ss/word"
+database: app
+sslmode: disable
+hosts:
+  - host: db2
+    port: 5433
+target_session_attrs: read-write
+application_name: api
+search_path: app,public
+statement_timeout: 5s
+pool:
+  max_conns: 20
+  max_conn_lifetime: 1h
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := cfg.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := pool.ConnConfig
+	if cc.Host != "db1" || cc.Port != 5432 || cc.Password != "p@ss/word" || cc.TLSConfig != nil {
+		t.Errorf("unexpected primary host %s:%d password %q tls %v", cc.Host, cc.Port, cc.Password, cc.TLSConfig)
+	}
+	if len(cc.Fallbacks) != 1 || cc.Fallbacks[0].Host != "db2" || cc.Fallbacks[0].Port != 5433 {
+		t.Errorf("unexpected fallbacks %+v", cc.Fallbacks)
+	}
+	if cc.ValidateConnect == nil {
+		t.Error("target_session_attrs not applied")
+	}
+	if cc.RuntimeParams["statement_timeout"] != "5000" || cc.RuntimeParams["search_path"] != "app,public" || cc.RuntimeParams["application_name"] != "api" {
+		t.Errorf("unexpected runtime params %v", cc.RuntimeParams)
+	}
+	if pool.MaxConns != 20 || pool.MaxConnLifetime != time.Hour {
+		t.Errorf("unexpected pool settings max_conns=%d max_conn_lifetime=%s", pool.MaxConns, pool.MaxConnLifetime)
+	}
+}
+
+func TestConfigIgnoresEnvironment(t *testing.T) {
+	passfile := filepath.Join(t.TempDir(), "pgpass")
+	if err := os.WriteFile(passfile, []byte("*:*:*:*:from-passfile\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"PGHOST":               "env-host",
+		"PGPORT":               "6543",
+		"PGDATABASE":           "env-db",
+		"PGUSER":               "env-user",
+		"PGPASSWORD":           "env-password",
+		"PGPASSFILE":           passfile,
+		"PGAPPNAME":            "env-app",
+		"PGCONNECT_TIMEOUT":    "30",
+		"PGSSLMODE":            "verify-full",
+		"PGSSLROOTCERT":        "/nonexistent/root.crt",
+		"PGSSLCERT":            "/nonexistent/client.crt",
+		"PGSSLKEY":             "/nonexistent/client.key",
+		"PGTARGETSESSIONATTRS": "read-write",
+	} {
+		t.Setenv(key, value)
+	}
+
+	cfg := Config{Hosts: []Host{{Host: "db2"}}}
+	cfg.Host, cfg.Database, cfg.User, cfg.SSLMode = "db1", "app", "it's\\me", "disable"
+	pool, err := cfg.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := pool.ConnConfig
+	if cc.Host != "db1" || cc.Port != defaultPort || cc.Database != "app" || cc.User != `it's\me` || cc.Password != "" {
+		t.Errorf("connection settings taken from the environment: %s:%d %s %q password %q", cc.Host, cc.Port, cc.Database, cc.User, cc.Password)
+	}
+	if len(cc.RuntimeParams) != 0 || cc.ConnectTimeout != 0 || cc.ValidateConnect != nil || cc.TLSConfig != nil {
+		t.Errorf("runtime params %v, connect timeout %s, validate %t, tls %v", cc.RuntimeParams, cc.ConnectTimeout, cc.ValidateConnect != nil, cc.TLSConfig)
+	}
+
+	cfg.ConnectTimeout = 1500 * time.Millisecond
+	cfg.Password = "secret"
+	if pool, err = cfg.PoolConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.ConnConfig.ConnectTimeout != cfg.ConnectTimeout || pool.ConnConfig.Password != "secret" {
+		t.Errorf("connect timeout %s, password %q", pool.ConnConfig.ConnectTimeout, pool.ConnConfig.Password)
+	}
+}
+
+func TestConfigHosts(t *testing.T) {
+	cfg := Config{Hosts: []Host{{Host: "db2", Port: 5433}, {Host: "db3"}}}
+	cfg.SSLMode = "disable"
+	pool, err := cfg.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := pool.ConnConfig
+	if cc.Host != "db2" || cc.Port != 5433 || len(cc.Fallbacks) != 1 || cc.Fallbacks[0].Host != "db3" {
+		t.Errorf("hosts-only config: primary %s:%d, fallbacks %+v", cc.Host, cc.Port, cc.Fallbacks)
+	}
+
+	for _, cfg := range []Config{
+		{},
+		{Hosts: []Host{{Port: 5432}}},
+		{Credentials: Credentials{Host: "db1", Port: 70000}},
+		{Credentials: Credentials{Host: "db1"}, Hosts: []Host{{Host: "db2", Port: -1}}},
+	} {
+		if _, err := cfg.PoolConfig(); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
@@ -3,59 +3,69 @@ package db
 import (
 	"context"
 	"fmt"
+	"github.com/bomjdev/yetanother/retry"
 	pgxuuid "github.com/jackc/pgx-gofrs-uuid"
 	pgxdecimal "github.com/jackc/pgx-shopspring-decimal"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/jackc/pgx/v5/tracelog"
-	"log"
 )
 
-type Credentials struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	Database string
-	SSLMode  string
-}
+type (
+	Credentials struct {
+		Host     string
+		Port     int
+		User     string
+		Password string
+		Database string
+		SSLMode  string
+	}
+
+	Option func(o *options)
 
-type traceLog struct {
-	l *log.Logger
+	options struct {
+		tracers []pgx.QueryTracer
+		retry   retry.Retry
+		types   []TypeRegistrar
+	}
+)
+
+func Connect(ctx context.Context, credentials Credentials, opts ...Option) (*pgxpool.Pool, error) {
+	return ConnectConfig(ctx, Config{Credentials: credentials}, opts...)
 }
 
-func (t traceLog) Log(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
-	if msg != "Query" {
-		return
+func ConnectConfig(ctx context.Context, config Config, opts ...Option) (*pgxpool.Pool, error) {
+	cfg, err := config.PoolConfig()
+	if err != nil {
+		return nil, fmt.Errorf("pool config: %w", err)
 	}
-	_ = t.l.Output(10, fmt.Sprint(data["sql"], data["args"]))
+	return connect(ctx, cfg, opts)
 }
 
-func Connect(ctx context.Context, credentials Credentials) (*pgxpool.Pool, error) {
-	cfg, err := pgxpool.ParseConfig(fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		credentials.User,
-		credentials.Password,
-		credentials.Host,
-		credentials.Port,
-		credentials.Database,
-		credentials.SSLMode,
-	))
+// ConnectDSN connects using a libpq connection string or URL.
+func ConnectDSN(ctx context.Context, dsn string, opts ...Option) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("parse config: %w", err)
+		return nil, fmt.Errorf("parse dsn: %w", err)
+	}
+	return connect(ctx, cfg, opts)
+}
+
+func connect(ctx context.Context, cfg *pgxpool.Config, opts []Option) (*pgxpool.Pool, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	//cfg.BeforeConnect = func(ctx context.Context, config *pgx.ConnConfig) error {
-	//	config.Tracer = &tracelog.TraceLog{
-	//		Logger:   traceLog{l: log.Default()},
-	//		LogLevel: tracelog.LogLevelInfo,
-	//	}
-	//	return nil
-	//}
+	cfg.ConnConfig.Tracer = newTracer(o.tracers)
 
 	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
 		pgxdecimal.Register(conn.TypeMap())
 		pgxuuid.Register(conn.TypeMap())
+		for _, register := range o.types {
+			if err := register(ctx, conn); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
@@ -64,5 +74,30 @@ func Connect(ctx context.Context, credentials Credentials) (*pgxpool.Pool, error
 		return nil, fmt.Errorf("connect: %w", err)
 	}
 
+	if o.retry != nil {
+		if err = o.retry(ctx, ping(pool)); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("wait for database: %w", err)
+		}
+	}
+
 	return pool, nil
 }
+
+// ping stops the retry once ctx is done instead of pinging until the retry
+// gives up on its own.
+func ping(pool *pgxpool.Pool) retry.Func {
+	return func(ctx context.Context) error {
+		err := pool.Ping(ctx)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", retry.ErrStop, err)
+		}
+		return err
+	}
+}
+
+func WithRetry(retry retry.Retry) Option {
+	return func(o *options) {
+		o.retry = retry
+	}
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/retry"
+	"testing"
+	"time"
+)
+
+func TestConnectRetryStopsOnContext(t *testing.T) {
+	cfg := Config{Credentials: Credentials{Host: "127.0.0.1", Port: 1, SSLMode: "disable"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	forever := retry.New(retry.Delay(retry.DelayOptions{Delay: time.Hour}))
+
+	start := time.Now()
+	_, err := ConnectConfig(ctx, cfg, WithRetry(forever))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+}
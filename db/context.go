@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"github.com/bomjdev/yetanother/query"
+	"github.com/jackc/pgx/v5"
+	"iter"
+)
+
+type executorKey struct{}
+
+func WithExecutor(ctx context.Context, executor Executor) context.Context {
+	return context.WithValue(ctx, executorKey{}, executor)
+}
+
+func ExecutorFrom(ctx context.Context, fallback Executor) Executor {
+	if executor, ok := ctx.Value(executorKey{}).(Executor); ok {
+		return executor
+	}
+	return fallback
+}
+
+// RunInContext runs fn in a transaction, nested as a savepoint when ctx
+// already carries one, with the transaction set as the context executor.
+func (p PGX) RunInContext(ctx context.Context, fn func(ctx context.Context) error) error {
+	return p.runInTransaction(ctx, func(ctx context.Context, _ pgx.Tx) error {
+		return fn(ctx)
+	})
+}
+
+func (f ExecFunc[T]) Context(fallback Executor) func(ctx context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		return f(ctx, ExecutorFrom(ctx, fallback))
+	}
+}
+
+func (f StmtExecFunc[T]) Context(fallback Executor) func(ctx context.Context, args ...any) (T, error) {
+	return func(ctx context.Context, args ...any) (T, error) {
+		return f(ctx, ExecutorFrom(ctx, fallback), args...)
+	}
+}
+
+type (
+	ContextExecScanner[T any] struct {
+		scanner  ExecScanner[T]
+		fallback Executor
+	}
+
+	ContextStmtScanner[T any] struct {
+		scanner  StmtScanner[T]
+		fallback Executor
+	}
+
+	ContextQueryScanner[T any] struct {
+		scanner  QueryScanner[T]
+		fallback Executor
+	}
+)
+
+func (s ExecScanner[T]) Context(fallback Executor) ContextExecScanner[T] {
+	return ContextExecScanner[T]{scanner: s, fallback: fallback}
+}
+
+func (s ContextExecScanner[T]) Scan(ctx context.Context) ([]T, error) {
+	return s.scanner.Scan(ctx, ExecutorFrom(ctx, s.fallback))
+}
+
+func (s ContextExecScanner[T]) ScanOne(ctx context.Context) (T, error) {
+	return s.scanner.ScanOne(ctx, ExecutorFrom(ctx, s.fallback))
+}
+
+func (s ContextExecScanner[T]) ScanExactlyOne(ctx context.Context) (T, error) {
+	return s.scanner.ScanExactlyOne(ctx, ExecutorFrom(ctx, s.fallback))
+}
+
+func (s ContextExecScanner[T]) Iter(ctx context.Context) iter.Seq2[T, error] {
+	return s.scanner.Iter(ctx, ExecutorFrom(ctx, s.fallback))
+}
+
+func (s StmtScanner[T]) Context(fallback Executor) ContextStmtScanner[T] {
+	return ContextStmtScanner[T]{scanner: s, fallback: fallback}
+}
+
+func (s ContextStmtScanner[T]) Scan(ctx context.Context, args ...any) ([]T, error) {
+	return s.scanner.Scan(ctx, ExecutorFrom(ctx, s.fallback), args...)
+}
+
+func (s ContextStmtScanner[T]) ScanOne(ctx context.Context, args ...any) (T, error) {
+	return s.scanner.ScanOne(ctx, ExecutorFrom(ctx, s.fallback), args...)
+}
+
+func (s ContextStmtScanner[T]) ScanExactlyOne(ctx context.Context, args ...any) (T, error) {
+	return s.scanner.ScanExactlyOne(ctx, ExecutorFrom(ctx, s.fallback), args...)
+}
+
+func (s ContextStmtScanner[T]) Iter(ctx context.Context, args ...any) iter.Seq2[T, error] {
+	return s.scanner.Iter(ctx, ExecutorFrom(ctx, s.fallback), args...)
+}
+
+func (s QueryScanner[T]) Context(fallback Executor) ContextQueryScanner[T] {
+	return ContextQueryScanner[T]{scanner: s, fallback: fallback}
+}
+
+func (s ContextQueryScanner[T]) Scan(ctx context.Context, query query.Query) ([]T, error) {
+	return s.scanner.Scan(ctx, ExecutorFrom(ctx, s.fallback), query)
+}
+
+func (s ContextQueryScanner[T]) ScanOne(ctx context.Context, query query.Query) (T, error) {
+	return s.scanner.ScanOne(ctx, ExecutorFrom(ctx, s.fallback), query)
+}
+
+func (s ContextQueryScanner[T]) ScanExactlyOne(ctx context.Context, query query.Query) (T, error) {
+	return s.scanner.ScanExactlyOne(ctx, ExecutorFrom(ctx, s.fallback), query)
+}
+
+func (s ContextQueryScanner[T]) Iter(ctx context.Context, query query.Query) iter.Seq2[T, error] {
+	return s.scanner.Iter(ctx, ExecutorFrom(ctx, s.fallback), query)
+}
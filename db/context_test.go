@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/query"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+type (
+	fakeStmt struct {
+		sql  string
+		args []any
+	}
+
+	// fakeExecutor records statements and answers queries with results in
+	// order, then with empty rows.
+	fakeExecutor struct {
+		stmts   []fakeStmt
+		results []*fakeRows
+		tag     pgconn.CommandTag
+		err     error
+	}
+
+	fakeRows struct {
+		columns []string
+		values  [][]any
+		pos     int
+		err     error
+		closed  bool
+	}
+
+	fakeQueryRow struct {
+		rows pgx.Rows
+		err  error
+	}
+)
+
+func (e *fakeExecutor) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	e.stmts = append(e.stmts, fakeStmt{sql: sql, args: args})
+	return e.tag, e.err
+}
+
+func (e *fakeExecutor) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	e.stmts = append(e.stmts, fakeStmt{sql: sql, args: args})
+	if e.err != nil {
+		return nil, e.err
+	}
+	if len(e.results) == 0 {
+		return &fakeRows{}, nil
+	}
+	rows := e.results[0]
+	e.results = e.results[1:]
+	return rows, nil
+}
+
+func (e *fakeExecutor) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := e.Query(ctx, sql, args...)
+	return fakeQueryRow{rows: rows, err: err}
+}
+
+func (r fakeQueryRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+func newFakeRows(columns []string, values ...[]any) *fakeRows {
+	return &fakeRows{columns: columns, values: values}
+}
+
+func (r *fakeRows) Next() bool {
+	if r.closed || r.pos >= len(r.values) {
+		r.closed = true
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *fakeRows) Close() {
+	r.closed = true
+}
+
+func (r *fakeRows) Err() error {
+	if r.closed {
+		return r.err
+	}
+	return nil
+}
+
+func (r *fakeRows) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag{}
+}
+
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	return fakeRow{columns: r.columns}.FieldDescriptions()
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return fakeRow{columns: r.columns, values: r.values[r.pos-1]}.Scan(dest...)
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return r.values[r.pos-1], nil
+}
+
+func (r *fakeRows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *fakeRows) Conn() *pgx.Conn {
+	return nil
+}
+
+func TestExecutorFrom(t *testing.T) {
+	fallback, carried := &fakeExecutor{}, &fakeExecutor{}
+	if ExecutorFrom(context.Background(), fallback) != fallback {
+		t.Error("fallback not used without a context executor")
+	}
+	if ExecutorFrom(WithExecutor(context.Background(), carried), fallback) != carried {
+		t.Error("context executor not used")
+	}
+}
+
+func TestRunInContext(t *testing.T) {
+	root := &fakeTx{}
+	p := PGX{}.WithTx(root)
+
+	err := p.RunInContext(context.Background(), func(ctx context.Context) error {
+		outer, ok := ExecutorFrom(ctx, nil).(*fakeTx)
+		if !ok || len(root.begun) != 1 || outer != root.begun[0] {
+			t.Fatalf("context executor = %v, want the new transaction", ExecutorFrom(ctx, nil))
+		}
+		if err := p.RunInContext(ctx, func(ctx context.Context) error {
+			if len(outer.begun) != 1 || ExecutorFrom(ctx, nil) != outer.begun[0] {
+				t.Error("nested RunInContext did not open a savepoint of the outer transaction")
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return p.RunInTransaction(ctx, func(tx pgx.Tx) error {
+			if len(outer.begun) != 2 || tx != outer.begun[1] {
+				t.Error("RunInTransaction did not nest in the context transaction")
+			}
+			return errors.New("rollback")
+		})
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("err = %v", err)
+	}
+	outer := root.begun[0]
+	if !outer.rolledBack || !outer.begun[0].committed || !outer.begun[1].rolledBack {
+		t.Errorf("outer rolled back = %t, savepoints committed = %t, rolled back = %t",
+			outer.rolledBack, outer.begun[0].committed, outer.begun[1].rolledBack)
+	}
+}
+
+func TestContextScanners(t *testing.T) {
+	newExecutor := func() *fakeExecutor {
+		return &fakeExecutor{results: []*fakeRows{newFakeRows([]string{"n"}, []any{1}, []any{2})}}
+	}
+	stmt := NewStmtFactoryWith("SELECT n FROM t WHERE n > $1", MapScalar[int])
+	exec := NewExecScannerWith(GetRows.WithStatement("SELECT n FROM t").WithArgs(), MapScalar[int])
+	list := NewQueryScannerWith(GetRows.SelectFactory(Postgres.Select("n").From("t")), MapScalar[int])
+
+	type testCase struct {
+		name string
+		scan func(ctx context.Context, fallback Executor) ([]int, error)
+	}
+	for _, tc := range []testCase{
+		{name: "stmt", scan: func(ctx context.Context, fallback Executor) ([]int, error) {
+			return stmt.Context(fallback).Scan(ctx, 0)
+		}},
+		{name: "exec", scan: func(ctx context.Context, fallback Executor) ([]int, error) {
+			return exec.Context(fallback).Scan(ctx)
+		}},
+		{name: "query", scan: func(ctx context.Context, fallback Executor) ([]int, error) {
+			return list.Context(fallback).Scan(ctx, query.Query{})
+		}},
+		{name: "exec func", scan: func(ctx context.Context, fallback Executor) ([]int, error) {
+			return ExecWithScanner(GetRows.WithStatement("SELECT n FROM t").WithArgs(), ScanWith(MapScalar[int])).Context(fallback)(ctx)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fallback, carried := newExecutor(), newExecutor()
+			if _, err := tc.scan(context.Background(), fallback); err != nil || len(fallback.stmts) != 1 {
+				t.Errorf("fallback statements = %v, err = %v", fallback.stmts, err)
+			}
+			values, err := tc.scan(WithExecutor(context.Background(), carried), fallback)
+			if err != nil || len(values) != 2 || len(carried.stmts) != 1 || len(fallback.stmts) != 1 {
+				t.Errorf("values = %v, err = %v, context statements = %v", values, err, carried.stmts)
+			}
+		})
+	}
+}
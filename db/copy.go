@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+type (
+	Copier interface {
+		Executor
+		Beginner
+		CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+	}
+
+	CopyOptions struct {
+		Conflict      []string
+		Progress      func(rows int64)
+		ProgressEvery int64
+	}
+)
+
+func CopyFromSlice[T any](ctx context.Context, copier Copier, table string, values []T, options CopyOptions) (int64, error) {
+	return CopyFrom(ctx, copier, table, slices.Values(values), options)
+}
+
+func CopyFromChan[T any](ctx context.Context, copier Copier, table string, values <-chan T, options CopyOptions) (int64, error) {
+	return CopyFrom(ctx, copier, table, func(yield func(T) bool) {
+		for v := range values {
+			if !yield(v) {
+				return
+			}
+		}
+	}, options)
+}
+
+// CopyFrom streams values with COPY, or merges them through a staging table
+// when options.Conflict is set. Like InsertStruct, primary key and omitempty
+// columns are left to their database defaults when empty; since COPY cannot
+// do that per row, the first value decides and later values must agree.
+// Scope columns are set on every row and a merge only updates rows within
+// the scope.
+func CopyFrom[T any](ctx context.Context, copier Copier, table string, values iter.Seq[T], options CopyOptions) (int64, error) {
+	fs, err := structFields[T]()
+	if err != nil {
+		return 0, err
+	}
+	src := newCopySource(fs, ScopeFrom(ctx), values, options)
+	defer src.stop()
+
+	if len(options.Conflict) == 0 {
+		n, err := copier.CopyFrom(ctx, identifier(table), src.columns, src)
+		return n, ClassifyError(err)
+	}
+
+	var n int64
+	err = RunInTransaction(ctx, copier, func(tx pgx.Tx) error {
+		n, err = copyMerge(ctx, tx, table, src.columns, src, options.Conflict)
+		return err
+	})
+	return n, err
+}
+
+var stageSeq atomic.Uint64
+
+func copyMerge(ctx context.Context, tx pgx.Tx, table string, columns []string, src pgx.CopyFromSource, conflict []string) (int64, error) {
+	stage := pgx.Identifier{fmt.Sprintf("_stage_%s_%d", strings.ReplaceAll(table, ".", "_"), stageSeq.Add(1))}
+	if _, err := Exec(Unscoped(ctx), tx, fmt.Sprintf(
+		"CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP",
+		stage.Sanitize(),
+		identifier(table).Sanitize(),
+	)); err != nil {
+		return 0, fmt.Errorf("create staging table: %w", err)
+	}
+
+	if _, err := tx.CopyFrom(ctx, stage, columns, src); err != nil {
+		return 0, fmt.Errorf("copy: %w", ClassifyError(err))
+	}
+
+	merge, err := OnConflictUpdate(Postgres.
+		Insert(table).
+		Columns(columns...).
+		Select(Postgres.Select(columns...).From(stage.Sanitize())), conflict, columns...)
+	if err != nil {
+		return 0, err
+	}
+	tag, err := Exec.WithBuilder(scoped(ScopeFrom(ctx).conflictWhere(merge, table)))(ctx, tx)
+	if err != nil {
+		return 0, fmt.Errorf("merge: %w", err)
+	}
+	// The caller's transaction may run further merges before ON COMMIT fires.
+	if _, err = Exec(Unscoped(ctx), tx, "DROP TABLE "+stage.Sanitize()); err != nil {
+		return 0, fmt.Errorf("drop staging table: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func identifier(table string) pgx.Identifier {
+	return strings.Split(table, ".")
+}
+
+type copySource[T any] struct {
+	fields   fields
+	defaults fields
+	columns  []string
+	scope    []scopeValue
+	next     func() (T, bool)
+	stop     func()
+	value    T
+	pending  bool
+	rows     int64
+	options  CopyOptions
+}
+
+// scopeValue is the value of the scope column at index in copied rows.
+type scopeValue struct {
+	index int
+	value any
+}
+
+// newCopySource reads the first value ahead to pick the columns: readonly
+// fields are never copied, primary key and omitempty fields only when set,
+// scope columns always.
+func newCopySource[T any](fs fields, scope Scope, values iter.Seq[T], options CopyOptions) *copySource[T] {
+	next, stop := iter.Pull(values)
+	s := &copySource[T]{next: next, stop: stop, options: options}
+	s.value, s.pending = next()
+	first := reflect.ValueOf(s.value)
+	for _, f := range fs {
+		switch {
+		case f.readonly:
+		case scope.scoped(f.name):
+			s.fields = append(s.fields, f)
+		case (f.pk || f.omitempty) && s.pending && f.value(first).IsZero():
+			s.defaults = append(s.defaults, f)
+		default:
+			s.fields = append(s.fields, f)
+		}
+	}
+	s.columns = s.fields.names()
+	for _, key := range slices.Sorted(maps.Keys(scope)) {
+		i := slices.Index(s.columns, unqualified(key))
+		if i < 0 {
+			i = len(s.columns)
+			s.columns = append(s.columns, unqualified(key))
+		}
+		s.scope = append(s.scope, scopeValue{index: i, value: scope[key]})
+	}
+	return s
+}
+
+func (s *copySource[T]) Next() bool {
+	if s.pending {
+		s.pending = false
+	} else {
+		v, ok := s.next()
+		if !ok {
+			s.stop()
+			if s.options.Progress != nil {
+				s.options.Progress(s.rows)
+			}
+			return false
+		}
+		s.value = v
+	}
+	s.rows++
+	if s.options.Progress != nil && s.options.ProgressEvery > 0 && s.rows%s.options.ProgressEvery == 0 {
+		s.options.Progress(s.rows)
+	}
+	return true
+}
+
+func (s *copySource[T]) Values() ([]any, error) {
+	value := reflect.ValueOf(s.value)
+	for _, f := range s.defaults {
+		if !f.value(value).IsZero() {
+			return nil, fmt.Errorf("row %d: %s is set but was empty in the first row", s.rows, f.name)
+		}
+	}
+	values := make([]any, len(s.columns))
+	for i, f := range s.fields {
+		fieldValue := f.value(value)
+		if (f.pk || f.omitempty) && fieldValue.IsZero() && !s.scoped(i) {
+			return nil, fmt.Errorf("row %d: %s is empty but was set in the first row", s.rows, f.name)
+		}
+		values[i] = fieldValue.Interface()
+	}
+	for _, v := range s.scope {
+		values[v.index] = v.value
+	}
+	return values, nil
+}
+
+func (s *copySource[T]) scoped(index int) bool {
+	return slices.ContainsFunc(s.scope, func(v scopeValue) bool {
+		return v.index == index
+	})
+}
+
+func (s *copySource[T]) Err() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type (
+	copyItem struct {
+		ID      int64  `db:"id,pk"`
+		Name    string `db:"name"`
+		Created string `db:"created,readonly"`
+	}
+
+	fakeCopier struct {
+		fakeExecutor
+		tx      *fakeTx
+		table   pgx.Identifier
+		columns []string
+		copied  [][]any
+	}
+)
+
+func (c *fakeCopier) Begin(context.Context) (pgx.Tx, error) {
+	return c.tx, nil
+}
+
+func (c *fakeCopier) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	c.table, c.columns = table, columns
+	return drainCopy(src, &c.copied)
+}
+
+func (tx *fakeTx) CopyFrom(_ context.Context, _ pgx.Identifier, _ []string, src pgx.CopyFromSource) (int64, error) {
+	return drainCopy(src, &tx.copied)
+}
+
+func drainCopy(src pgx.CopyFromSource, copied *[][]any) (int64, error) {
+	var n int64
+	for src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return n, err
+		}
+		*copied = append(*copied, values)
+		n++
+	}
+	return n, src.Err()
+}
+
+func TestCopyFrom(t *testing.T) {
+	var progress []int64
+	copier := &fakeCopier{}
+	n, err := CopyFromSlice(context.Background(), copier, "app.items", []copyItem{{Name: "a"}, {Name: "b"}, {Name: "c"}}, CopyOptions{
+		Progress:      func(rows int64) { progress = append(progress, rows) },
+		ProgressEvery: 2,
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("CopyFrom = %d, %v", n, err)
+	}
+	if !slices.Equal(copier.table, pgx.Identifier{"app", "items"}) || !slices.Equal(copier.columns, []string{"name"}) {
+		t.Errorf("copied into %v columns %v", copier.table, copier.columns)
+	}
+	if len(copier.copied) != 3 || copier.copied[2][0] != "c" {
+		t.Errorf("copied rows %v", copier.copied)
+	}
+	if !slices.Equal(progress, []int64{2, 3}) {
+		t.Errorf("progress = %v, want [2 3]", progress)
+	}
+
+	copier = &fakeCopier{}
+	if _, err = CopyFromSlice(context.Background(), copier, "items", []copyItem{{ID: 1, Name: "a"}}, CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(copier.columns, []string{"id", "name"}) {
+		t.Errorf("columns with a set primary key = %v", copier.columns)
+	}
+
+	for _, values := range [][]copyItem{
+		{{Name: "a"}, {ID: 2, Name: "b"}},
+		{{ID: 1, Name: "a"}, {Name: "b"}},
+	} {
+		if _, err = CopyFromSlice(context.Background(), &fakeCopier{}, "items", values, CopyOptions{}); err == nil {
+			t.Errorf("mixed primary keys %v accepted", values)
+		}
+	}
+}
+
+func TestCopyFromEmpty(t *testing.T) {
+	copier := &fakeCopier{}
+	values := make(chan copyItem)
+	close(values)
+	n, err := CopyFromChan(context.Background(), copier, "items", values, CopyOptions{})
+	if err != nil || n != 0 || !slices.Equal(copier.columns, []string{"id", "name"}) {
+		t.Errorf("CopyFrom = %d, %v, columns %v", n, err, copier.columns)
+	}
+}
+
+func TestCopyMerge(t *testing.T) {
+	root := &fakeTx{}
+	copier := &fakeCopier{tx: root}
+	for range 2 {
+		if _, err := CopyFromSlice(context.Background(), copier, "items", []copyItem{{ID: 1, Name: "a"}}, CopyOptions{Conflict: []string{"id"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !root.committed || len(root.copied) != 2 || len(root.execs) != 6 {
+		t.Fatalf("committed = %t, copied %v, statements %v", root.committed, root.copied, root.execs)
+	}
+	var stages []string
+	for i := 0; i < len(root.execs); i += 3 {
+		create, merge, drop := root.execs[i][0].(string), root.execs[i+1][0].(string), root.execs[i+2][0].(string)
+		stage := strings.Fields(create)[3]
+		stages = append(stages, stage)
+		if want := "INSERT INTO items (id,name) SELECT id, name FROM " + stage + " ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name"; merge != want {
+			t.Errorf("merge = %q, want %q", merge, want)
+		}
+		if drop != "DROP TABLE "+stage {
+			t.Errorf("drop = %q", drop)
+		}
+	}
+	if stages[0] == stages[1] {
+		t.Errorf("staging table %s reused", stages[0])
+	}
+}
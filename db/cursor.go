@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"sync/atomic"
+)
+
+const DefaultFetchSize = 1000
+
+type cursorExecutor struct {
+	Executor
+	fetchSize int
+}
+
+var cursorSeq atomic.Uint64
+
+// Cursor wraps an executor running inside a transaction so that queries are
+// read through a server-side cursor, fetchSize rows per round-trip. The scope
+// is applied by the functions running the queries, see Scope.
+func Cursor(tx Executor, fetchSize int) Executor {
+	if fetchSize <= 0 {
+		fetchSize = DefaultFetchSize
+	}
+	return cursorExecutor{Executor: tx, fetchSize: fetchSize}
+}
+
+func (e cursorExecutor) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	name := pgx.Identifier{fmt.Sprintf("cursor_%d", cursorSeq.Add(1))}.Sanitize()
+	if _, err := e.Executor.Exec(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", name, sql), args...); err != nil {
+		return nil, fmt.Errorf("declare cursor: %w", err)
+	}
+	return &cursorRows{
+		ctx:      ctx,
+		executor: e.Executor,
+		name:     name,
+		fetch:    fmt.Sprintf("FETCH %d FROM %s", e.fetchSize, name),
+		size:     e.fetchSize,
+	}, nil
+}
+
+type cursorRows struct {
+	ctx      context.Context
+	executor Executor
+	name     string
+	fetch    string
+	size     int
+	rows     pgx.Rows
+	fetched  int
+	total    int64
+	done     bool
+	closed   bool
+	err      error
+}
+
+func (r *cursorRows) Next() bool {
+	for !r.done {
+		if r.rows != nil {
+			if r.rows.Next() {
+				r.fetched++
+				r.total++
+				return true
+			}
+			r.rows.Close()
+			if err := r.rows.Err(); err != nil {
+				r.err = err
+				break
+			}
+			if r.fetched < r.size {
+				break
+			}
+		}
+		r.rows, r.err = r.executor.Query(r.ctx, r.fetch)
+		r.fetched = 0
+		if r.err != nil {
+			break
+		}
+	}
+	r.Close()
+	return false
+}
+
+func (r *cursorRows) Close() {
+	if r.closed {
+		return
+	}
+	r.closed, r.done = true, true
+	if r.rows != nil {
+		r.rows.Close()
+	}
+	if r.err != nil {
+		return
+	}
+	if _, err := r.executor.Exec(r.ctx, "CLOSE "+r.name); err != nil {
+		r.err = fmt.Errorf("close cursor: %w", err)
+	}
+}
+
+func (r *cursorRows) Err() error {
+	return r.err
+}
+
+func (r *cursorRows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", r.total))
+}
+
+func (r *cursorRows) FieldDescriptions() []pgconn.FieldDescription {
+	if r.rows == nil {
+		return nil
+	}
+	return r.rows.FieldDescriptions()
+}
+
+func (r *cursorRows) Scan(dest ...any) error {
+	return r.rows.Scan(dest...)
+}
+
+func (r *cursorRows) Values() ([]any, error) {
+	return r.rows.Values()
+}
+
+func (r *cursorRows) RawValues() [][]byte {
+	return r.rows.RawValues()
+}
+
+func (r *cursorRows) Conn() *pgx.Conn {
+	if r.rows == nil {
+		return nil
+	}
+	return r.rows.Conn()
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func cursorStmts(executor *fakeExecutor) []string {
+	sqls := make([]string, len(executor.stmts))
+	for i, stmt := range executor.stmts {
+		sqls[i] = stmt.sql
+	}
+	return sqls
+}
+
+func TestCursor(t *testing.T) {
+	ctx := context.Background()
+	tx := &fakeExecutor{results: []*fakeRows{
+		newFakeRows([]string{"n"}, []any{1}, []any{2}),
+		newFakeRows([]string{"n"}, []any{3}),
+	}}
+	rows, err := Cursor(tx, 2).Query(ctx, "SELECT n FROM numbers WHERE n > $1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ScanWith(MapScalar[int])(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("rows = %v", got)
+	}
+	if tag := rows.CommandTag(); tag.RowsAffected() != 3 {
+		t.Errorf("command tag = %v", tag)
+	}
+	stmts := cursorStmts(tx)
+	name, _ := strings.CutPrefix(stmts[len(stmts)-1], "CLOSE ")
+	want := []string{
+		"DECLARE " + name + " NO SCROLL CURSOR FOR SELECT n FROM numbers WHERE n > $1",
+		"FETCH 2 FROM " + name,
+		"FETCH 2 FROM " + name,
+		"CLOSE " + name,
+	}
+	if !slices.Equal(stmts, want) {
+		t.Errorf("statements = %q\nwant %q", stmts, want)
+	}
+	if !slices.Equal(tx.stmts[0].args, []any{0}) {
+		t.Errorf("declare args = %v", tx.stmts[0].args)
+	}
+}
+
+func TestCursorFullLastBatch(t *testing.T) {
+	tx := &fakeExecutor{results: []*fakeRows{newFakeRows([]string{"n"}, []any{1}, []any{2})}}
+	rows, err := Cursor(tx, 2).Query(context.Background(), "SELECT n FROM numbers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ScanWith(MapScalar[int])(rows); err != nil || len(got) != 2 {
+		t.Fatalf("rows = %v, %v", got, err)
+	}
+	// A full batch may be the last one: the empty fetch after it ends the scan.
+	if n := len(tx.stmts); n != 4 {
+		t.Errorf("statements = %q", cursorStmts(tx))
+	}
+}
+
+func TestCursorEarlyBreak(t *testing.T) {
+	tx := &fakeExecutor{results: []*fakeRows{newFakeRows([]string{"n"}, []any{1}, []any{2})}}
+	rows, err := Cursor(tx, 0).Query(context.Background(), "SELECT n FROM numbers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := ScanIterWith(MapScalar[int])(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, err := range seq {
+		if err != nil || n != 1 {
+			t.Fatalf("first row = %d, %v", n, err)
+		}
+		break
+	}
+	stmts := cursorStmts(tx)
+	if len(stmts) != 3 || stmts[1] != "FETCH 1000 FROM "+stmts[2][len("CLOSE "):] {
+		t.Errorf("statements = %q", stmts)
+	}
+}
+
+func TestCursorErrors(t *testing.T) {
+	ctx := context.Background()
+	errDeclare := errors.New("syntax error")
+	if _, err := Cursor(&fakeExecutor{err: errDeclare}, 10).Query(ctx, "SELECT"); !errors.Is(err, errDeclare) {
+		t.Errorf("declare error = %v", err)
+	}
+
+	errFetch := errors.New("canceling statement")
+	failed := newFakeRows([]string{"n"}, []any{1})
+	failed.err = errFetch
+	tx := &fakeExecutor{results: []*fakeRows{failed}}
+	rows, err := Cursor(tx, 10).Query(ctx, "SELECT n FROM numbers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanWith(MapScalar[int])(rows); !errors.Is(err, errFetch) {
+		t.Errorf("fetch error = %v", err)
+	}
+	// The transaction is aborted after an error, so the cursor is not closed.
+	if stmts := cursorStmts(tx); len(stmts) != 2 {
+		t.Errorf("statements = %q", stmts)
+	}
+}
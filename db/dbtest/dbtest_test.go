@@ -0,0 +1,133 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/bomjdev/yetanother/query"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type user struct {
+	ID    int64   `db:"id"`
+	Name  string  `db:"name"`
+	Email *string `db:"email"`
+}
+
+func TestFakeQuery(t *testing.T) {
+	fake := NewFake(t)
+	rows, err := RowsFromCSV(`
+		id, name, email
+		1, alice, alice@example.com
+		2, bob, NULL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.ExpectQuery("SELECT id, name, email\n  FROM users WHERE id > $1").WithArgs(0).WillReturnRows(rows)
+
+	users, err := db.NewStmtFactory[user]("SELECT id, name, email FROM users WHERE id > $1").Scan(context.Background(), fake, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || *users[0].Email != "alice@example.com" || users[1].Email != nil {
+		t.Errorf("users = %+v", users)
+	}
+}
+
+func TestFakeStructsAndErrors(t *testing.T) {
+	fake := NewFake(t).WithMatcher(MatchRegexp)
+	rows, err := RowsFromStructs(user{ID: 7, Name: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.ExpectQuery(`^SELECT .* FROM users`).WillReturnRows(rows)
+	fake.ExpectExec(`^DELETE FROM users`).WillReturnError(db.ErrConflict)
+
+	ctx := context.Background()
+	u, err := db.NewStmtFactory[user]("SELECT * FROM users LIMIT 1").ScanExactlyOne(ctx, fake)
+	if err != nil || u.ID != 7 || u.Name != "carol" {
+		t.Errorf("ScanExactlyOne = %+v, %v", u, err)
+	}
+	if _, err = db.Exec(ctx, fake, "DELETE FROM users"); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("Exec error = %v", err)
+	}
+}
+
+type recordT struct {
+	testing.TB
+	errors int
+}
+
+func (t *recordT) Error(...any) {
+	t.errors++
+}
+
+func (t *recordT) Errorf(string, ...any) {
+	t.errors++
+}
+
+func TestFakeUnexpected(t *testing.T) {
+	inner := &recordT{TB: t}
+	fake := &Fake{t: inner, match: MatchNormalized}
+	fake.ExpectExec("UPDATE users SET name = $1").WithArgs("x")
+	if _, err := fake.Exec(context.Background(), "UPDATE users SET name = $1", "y"); !errors.Is(err, ErrUnexpected) || inner.errors != 1 {
+		t.Errorf("mismatched args: %v", err)
+	}
+	if err := fake.ExpectationsWereMet(); err == nil {
+		t.Error("unmet expectation not reported")
+	}
+}
+
+func TestRecorderGolden(t *testing.T) {
+	recorder := NewRecorder(nil)
+	ctx := context.Background()
+	if _, err := db.Exec(ctx, recorder, "UPDATE users   SET name = $1\nWHERE id = $2", "dave", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.NewStmtFactory[user]("SELECT * FROM users").Scan(ctx, recorder); err != nil {
+		t.Fatal(err)
+	}
+	recorder.AssertGolden(t, filepath.Join("testdata", "recorder.golden"))
+}
+
+func TestRecorderAssertScoped(t *testing.T) {
+	type account struct {
+		ID       int64  `db:"id,pk"`
+		TenantID int64  `db:"tenant_id"`
+		Name     string `db:"name"`
+	}
+	repo, err := db.NewRepository[account, int64]("accounts", db.RepositoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := db.Scope{"tenant_id": int64(7)}
+	ctx := db.WithScope(context.Background(), scope)
+	recorder := NewRecorder(nil)
+
+	_, _ = repo.Get(ctx, recorder, 1)
+	_, _ = repo.List(ctx, recorder, query.Query{Filters: map[string][]query.Filter{"tenant_id": {{Value: "8"}}}})
+	_, _ = repo.Insert(ctx, recorder, account{Name: "a", TenantID: 8})
+	_, _ = repo.Upsert(ctx, recorder, account{ID: 1, Name: "a", TenantID: 8})
+	_, _ = repo.Update(ctx, recorder, account{ID: 1, Name: "a"}, account{ID: 1, Name: "b", TenantID: 8})
+	_ = repo.Delete(ctx, recorder, 1)
+	recorder.AssertScoped(t, scope)
+	for _, stmt := range recorder.Statements() {
+		if slices.Contains(stmt.Args, any(int64(8))) {
+			t.Errorf("statement takes the tenant from the value: %s %v", Normalize(stmt.SQL), stmt.Args)
+		}
+	}
+
+	if _, err = db.Exec(ctx, recorder, "DELETE FROM accounts"); !errors.Is(err, db.ErrUnscoped) {
+		t.Errorf("raw statement under a scope: %v", err)
+	}
+	recorder.AssertScoped(t, scope)
+
+	inner := &recordT{TB: t}
+	_, _ = db.Exec(db.Unscoped(ctx), recorder, "DELETE FROM accounts")
+	recorder.AssertScoped(inner, scope)
+	if inner.errors != 1 {
+		t.Errorf("unscoped statement reported %d times", inner.errors)
+	}
+}
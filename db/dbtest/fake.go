@@ -0,0 +1,213 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type (
+	Matcher func(expected, actual string) bool
+
+	// Fake is a scriptable db.Executor. Statements must arrive in the order
+	// they were expected; anything else fails the test.
+	Fake struct {
+		t            testing.TB
+		mu           sync.Mutex
+		match        Matcher
+		expectations []*Expectation
+	}
+
+	Expectation struct {
+		kind    string
+		sql     string
+		match   Matcher
+		args    []any
+		anyArgs bool
+		rows    *Rows
+		tag     pgconn.CommandTag
+		err     error
+		done    bool
+	}
+)
+
+var (
+	ErrUnexpected = errors.New("unexpected statement")
+
+	MatchExact Matcher = func(expected, actual string) bool {
+		return expected == actual
+	}
+
+	MatchNormalized Matcher = func(expected, actual string) bool {
+		return Normalize(expected) == Normalize(actual)
+	}
+
+	MatchRegexp Matcher = func(expected, actual string) bool {
+		ok, err := regexp.MatchString(expected, actual)
+		return err == nil && ok
+	}
+)
+
+// Normalize collapses whitespace so that formatting differences between the
+// expected and executed SQL do not matter.
+func Normalize(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// NewFake returns a Fake matching SQL with MatchNormalized. Expectations left
+// unmet when the test ends are reported as errors.
+func NewFake(t testing.TB) *Fake {
+	f := &Fake{t: t, match: MatchNormalized}
+	t.Cleanup(func() {
+		if err := f.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return f
+}
+
+func (f *Fake) WithMatcher(match Matcher) *Fake {
+	f.match = match
+	return f
+}
+
+func (f *Fake) ExpectQuery(sql string) *Expectation {
+	return f.expect("query", sql)
+}
+
+func (f *Fake) ExpectExec(sql string) *Expectation {
+	return f.expect("exec", sql)
+}
+
+func (f *Fake) expect(kind, sql string) *Expectation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := &Expectation{kind: kind, sql: sql, anyArgs: true}
+	f.expectations = append(f.expectations, e)
+	return e
+}
+
+func (f *Fake) ExpectationsWereMet() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for _, e := range f.expectations {
+		if !e.done {
+			errs = append(errs, fmt.Errorf("%s not executed: %s", e.kind, e.sql))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *Fake) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	e, err := f.next("exec", sql, args)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return e.tag, e.err
+}
+
+func (f *Fake) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	e, err := f.next("query", sql, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.rows.iterate(), nil
+}
+
+func (f *Fake) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := f.Query(ctx, sql, args...)
+	return row{rows: rows, err: err}
+}
+
+func (f *Fake) next(kind, sql string, args []any) (*Expectation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.expectations {
+		if e.done {
+			continue
+		}
+		if err := e.check(kind, sql, args, f.match); err != nil {
+			f.t.Error(err)
+			return nil, err
+		}
+		e.done = true
+		return e, nil
+	}
+	err := fmt.Errorf("%w: %s %s %v", ErrUnexpected, kind, sql, args)
+	f.t.Error(err)
+	return nil, err
+}
+
+// WithArgs requires the statement to be executed with exactly args.
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args, e.anyArgs = args, false
+	return e
+}
+
+// Match overrides the Fake matcher for this expectation only.
+func (e *Expectation) Match(match Matcher) *Expectation {
+	e.match = match
+	return e
+}
+
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult sets the command tag returned by Exec, e.g. "UPDATE 1".
+func (e *Expectation) WillReturnResult(tag string) *Expectation {
+	e.tag = pgconn.NewCommandTag(tag)
+	return e
+}
+
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) check(kind, sql string, args []any, match Matcher) error {
+	if e.match != nil {
+		match = e.match
+	}
+	if kind != e.kind {
+		return fmt.Errorf("%w: %s %s, want %s %s", ErrUnexpected, kind, sql, e.kind, e.sql)
+	}
+	if !match(e.sql, sql) {
+		return fmt.Errorf("%w: %s\nwant: %s", ErrUnexpected, sql, e.sql)
+	}
+	if !e.anyArgs && !reflect.DeepEqual(e.args, args) && !(len(e.args) == 0 && len(args) == 0) {
+		return fmt.Errorf("%w: %s args %v, want %v", ErrUnexpected, sql, args, e.args)
+	}
+	return nil
+}
+
+type row struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
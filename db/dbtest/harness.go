@@ -0,0 +1,268 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io/fs"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type (
+	Isolation int
+
+	Option func(o *options)
+
+	options struct {
+		env        string
+		isolation  Isolation
+		template   string
+		migrations []string
+		fsys       fs.FS
+		connect    []db.Option
+	}
+
+	// DB is a database prepared for a single test. Name is the schema or
+	// database created for it, empty with IsolateTx.
+	DB struct {
+		db.PGX
+		Name string
+	}
+)
+
+const (
+	// IsolateSchema creates a schema per test and points search_path at it.
+	IsolateSchema Isolation = iota
+	// IsolateDatabase clones a database per test from a template holding the
+	// migrations, built once per migration set.
+	IsolateDatabase
+	// IsolateTx runs migrations and the whole test inside a transaction that
+	// is rolled back on cleanup.
+	IsolateTx
+)
+
+// DSNEnv names the environment variable holding the connection string; tests
+// using New are skipped when it is empty.
+const DSNEnv = "DBTEST_DSN"
+
+var seq atomic.Uint64
+
+func WithDSNEnv(name string) Option {
+	return func(o *options) {
+		o.env = name
+	}
+}
+
+func WithIsolation(isolation Isolation) Option {
+	return func(o *options) {
+		o.isolation = isolation
+	}
+}
+
+// WithTemplate clones an existing database with IsolateDatabase instead of
+// building one from the migrations; migrations still run on the clone.
+func WithTemplate(name string) Option {
+	return func(o *options) {
+		o.template = name
+	}
+}
+
+func WithMigrations(stmts ...string) Option {
+	return func(o *options) {
+		o.migrations = append(o.migrations, stmts...)
+	}
+}
+
+// WithMigrationsFS runs every *.sql file at the root of fsys in name order,
+// after the statements given to WithMigrations.
+func WithMigrationsFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+func WithConnectOptions(opts ...db.Option) Option {
+	return func(o *options) {
+		o.connect = append(o.connect, opts...)
+	}
+}
+
+func New(t testing.TB, opts ...Option) DB {
+	t.Helper()
+	o := options{env: DSNEnv}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dsn := os.Getenv(o.env)
+	if dsn == "" {
+		t.Skipf("%s is not set", o.env)
+	}
+	migrations, err := o.load()
+	if err != nil {
+		t.Fatalf("load migrations: %s", err)
+	}
+
+	ctx := context.Background()
+	switch o.isolation {
+	case IsolateTx:
+		pool := connect(t, dsn, o.connect)
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			t.Fatalf("begin: %s", err)
+		}
+		t.Cleanup(func() {
+			_ = tx.Rollback(ctx)
+		})
+		if err = migrate(ctx, tx, migrations); err != nil {
+			t.Fatal(err)
+		}
+		return DB{PGX: db.New(pool).WithTx(tx)}
+
+	case IsolateDatabase:
+		admin := connect(t, dsn, nil)
+		template := o.template
+		if template == "" {
+			template = fmt.Sprintf("dbtest_template_%x", uint64(db.LockKey(strings.Join(migrations, ";\n"))))
+			if err = ensureTemplate(ctx, admin, dsn, template, migrations); err != nil {
+				t.Fatalf("template %q: %s", template, err)
+			}
+			migrations = nil
+		}
+		name := uniqueName()
+		exec(t, admin, fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pgx.Identifier{name}.Sanitize(), pgx.Identifier{template}.Sanitize()))
+		t.Cleanup(func() {
+			_, _ = admin.Exec(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", pgx.Identifier{name}.Sanitize()))
+		})
+		pool := connect(t, withParam(dsn, "dbname", name), o.connect)
+		if err = migrate(ctx, pool, migrations); err != nil {
+			t.Fatal(err)
+		}
+		return DB{PGX: db.New(pool), Name: name}
+
+	default:
+		admin := connect(t, dsn, nil)
+		name := uniqueName()
+		exec(t, admin, "CREATE SCHEMA "+pgx.Identifier{name}.Sanitize())
+		t.Cleanup(func() {
+			_, _ = admin.Exec(ctx, fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", pgx.Identifier{name}.Sanitize()))
+		})
+		pool := connect(t, withParam(dsn, "search_path", name), o.connect)
+		if err = migrate(ctx, pool, migrations); err != nil {
+			t.Fatal(err)
+		}
+		return DB{PGX: db.New(pool), Name: name}
+	}
+}
+
+func (o options) load() ([]string, error) {
+	migrations := append([]string(nil), o.migrations...)
+	if o.fsys == nil {
+		return migrations, nil
+	}
+	names, err := fs.Glob(o.fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		b, err := fs.ReadFile(o.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, string(b))
+	}
+	return migrations, nil
+}
+
+func connect(t testing.TB, dsn string, opts []db.Option) *pgxpool.Pool {
+	t.Helper()
+	pool, err := db.ConnectDSN(context.Background(), dsn, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func exec(t testing.TB, executor db.Executor, stmt string) {
+	t.Helper()
+	if _, err := executor.Exec(context.Background(), stmt); err != nil {
+		t.Fatalf("%s: %s", stmt, err)
+	}
+}
+
+func migrate(ctx context.Context, executor db.Executor, migrations []string) error {
+	for i, stmt := range migrations {
+		if _, err := executor.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ensureTemplate creates the template database unless another test, possibly
+// in another process, already did. An advisory lock serializes the check.
+func ensureTemplate(ctx context.Context, admin *pgxpool.Pool, dsn, name string, migrations []string) error {
+	conn, err := admin.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if err = db.AdvisoryLock(ctx, conn, name); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = db.AdvisoryUnlock(ctx, conn, name)
+	}()
+
+	var exists bool
+	if err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil || exists {
+		return err
+	}
+	if _, err = conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{name}.Sanitize()); err != nil {
+		return err
+	}
+	if err = buildTemplate(ctx, withParam(dsn, "dbname", name), migrations); err != nil {
+		_, _ = conn.Exec(ctx, "DROP DATABASE "+pgx.Identifier{name}.Sanitize())
+		return err
+	}
+	return nil
+}
+
+func buildTemplate(ctx context.Context, dsn string, migrations []string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close(ctx)
+	}()
+	return migrate(ctx, conn, migrations)
+}
+
+func uniqueName() string {
+	return fmt.Sprintf("dbtest_%d_%d_%x", os.Getpid(), seq.Add(1), rand.Uint32())
+}
+
+// withParam sets a connection parameter in either a URL or a keyword/value
+// connection string; in the latter a repeated keyword overrides earlier ones.
+func withParam(dsn, key, value string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if key == "dbname" {
+			u.Path = "/" + value
+			return u.String()
+		}
+		q := u.Query()
+		q.Set(key, value)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return fmt.Sprintf("%s %s='%s'", dsn, key, value)
+}
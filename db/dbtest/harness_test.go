@@ -0,0 +1,44 @@
+package dbtest
+
+import (
+	"context"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5"
+	"testing"
+)
+
+func TestWithParam(t *testing.T) {
+	for _, tc := range []struct{ dsn, key, value, want string }{
+		{"postgres://u@localhost:5432/app?sslmode=disable", "search_path", "s1", "postgres://u@localhost:5432/app?search_path=s1&sslmode=disable"},
+		{"postgres://u@localhost/app", "dbname", "other", "postgres://u@localhost/other"},
+		{"host=localhost dbname=app", "dbname", "it's", `host=localhost dbname=app dbname='it\'s'`},
+	} {
+		if got := withParam(tc.dsn, tc.key, tc.value); got != tc.want {
+			t.Errorf("withParam(%q, %q) = %q, want %q", tc.dsn, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for name, isolation := range map[string]Isolation{
+		"schema":   IsolateSchema,
+		"database": IsolateDatabase,
+		"tx":       IsolateTx,
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := New(t, WithIsolation(isolation), WithMigrations("CREATE TABLE items (id int PRIMARY KEY)"))
+			ctx := context.Background()
+			err := d.RunInTransaction(ctx, func(tx pgx.Tx) error {
+				_, err := db.Exec(ctx, tx, "INSERT INTO items VALUES (1)")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := db.NewStmtFactoryWith("SELECT count(*) FROM items", db.MapScalar[int]).ScanExactlyOne(ctx, d)
+			if err != nil || n != 1 {
+				t.Errorf("count = %d, %v", n, err)
+			}
+		})
+	}
+}
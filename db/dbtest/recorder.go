@@ -0,0 +1,146 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type (
+	Statement struct {
+		Kind string
+		SQL  string
+		Args []any
+	}
+
+	// Recorder wraps an executor and records every statement passed through
+	// it. The zero Executor is allowed: statements are recorded and return
+	// empty results.
+	Recorder struct {
+		executor   db.Executor
+		mu         sync.Mutex
+		statements []Statement
+	}
+)
+
+// UpdateEnv names the environment variable that makes AssertGolden rewrite
+// golden files instead of comparing against them.
+const UpdateEnv = "DBTEST_UPDATE"
+
+func NewRecorder(executor db.Executor) *Recorder {
+	return &Recorder{executor: executor}
+}
+
+func (r *Recorder) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	r.record("exec", sql, args)
+	if r.executor == nil {
+		return pgconn.CommandTag{}, nil
+	}
+	return r.executor.Exec(ctx, sql, args...)
+}
+
+func (r *Recorder) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	r.record("query", sql, args)
+	if r.executor == nil {
+		return NewRows().iterate(), nil
+	}
+	return r.executor.Query(ctx, sql, args...)
+}
+
+func (r *Recorder) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	r.record("query", sql, args)
+	if r.executor == nil {
+		return row{rows: NewRows().iterate()}
+	}
+	return r.executor.QueryRow(ctx, sql, args...)
+}
+
+func (r *Recorder) record(kind, sql string, args []any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, Statement{Kind: kind, SQL: sql, Args: args})
+}
+
+func (r *Recorder) Statements() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Statement(nil), r.statements...)
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = nil
+}
+
+// String formats the recorded statements with normalized SQL, one block per
+// statement, as stored in golden files.
+func (r *Recorder) String() string {
+	var b strings.Builder
+	for i, stmt := range r.Statements() {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "-- %s\n%s\n", stmt.Kind, Normalize(stmt.SQL))
+		for n, arg := range stmt.Args {
+			fmt.Fprintf(&b, "-- $%d = %#v\n", n+1, arg)
+		}
+	}
+	return b.String()
+}
+
+// AssertGolden compares the recorded statements with the golden file at path,
+// rewriting it instead when the UpdateEnv variable is set.
+func (r *Recorder) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+	got := r.String()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (set %s=1 to create it): %s", UpdateEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("statements differ from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// AssertScoped fails the test for every recorded statement that does not
+// mention each scope column with its value among the arguments.
+func (r *Recorder) AssertScoped(t testing.TB, scope db.Scope) {
+	t.Helper()
+	for _, stmt := range r.Statements() {
+		for column, value := range scope {
+			if !stmt.scoped(column, value) {
+				t.Errorf("statement not scoped by %s = %v: %s", column, value, Normalize(stmt.SQL))
+			}
+		}
+	}
+}
+
+func (s Statement) scoped(column string, value any) bool {
+	name := column[strings.LastIndexByte(column, '.')+1:]
+	if !regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).MatchString(s.SQL) {
+		return false
+	}
+	return slices.ContainsFunc(s.Args, func(arg any) bool {
+		return reflect.DeepEqual(arg, value)
+	})
+}
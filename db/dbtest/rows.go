@@ -0,0 +1,256 @@
+package dbtest
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Rows is a canned result set. It may be returned by several expectations;
+	// every query iterates it from the start.
+	Rows struct {
+		columns []string
+		values  [][]any
+		err     error
+	}
+
+	rows struct {
+		*Rows
+		pos    int
+		closed bool
+	}
+)
+
+// Null is the CSV cell value read as SQL NULL.
+const Null = "NULL"
+
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+func (r *Rows) AddRow(values ...any) *Rows {
+	r.values = append(r.values, values)
+	return r
+}
+
+// RowError makes iteration fail with err after all rows are read.
+func (r *Rows) RowError(err error) *Rows {
+	r.err = err
+	return r
+}
+
+// RowsFromStructs builds rows from struct values using the same db tags as
+// the rest of the package.
+func RowsFromStructs[T any](values ...T) (*Rows, error) {
+	columns, err := db.Columns[T]()
+	if err != nil {
+		return nil, err
+	}
+	r := NewRows(columns...)
+	for _, v := range values {
+		row, err := db.Values(v)
+		if err != nil {
+			return nil, err
+		}
+		r.AddRow(row...)
+	}
+	return r, nil
+}
+
+// RowsFromCSV builds rows from CSV text whose first record is the header.
+// Cells are strings converted on Scan; a cell equal to Null is NULL.
+func RowsFromCSV(text string) (*Rows, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimSpace(text)))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	r := NewRows(header...)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return r, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read record: %w", err)
+		}
+		row := make([]any, len(record))
+		for i, cell := range record {
+			if cell != Null {
+				row[i] = cell
+			}
+		}
+		r.AddRow(row...)
+	}
+}
+
+func (r *Rows) iterate() *rows {
+	if r == nil {
+		r = NewRows()
+	}
+	return &rows{Rows: r, pos: -1}
+}
+
+func (r *rows) Next() bool {
+	if r.closed || r.pos+1 >= len(r.values) {
+		r.closed = true
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *rows) Close() {
+	r.closed = true
+}
+
+func (r *rows) Err() error {
+	if r.closed {
+		return r.Rows.err
+	}
+	return nil
+}
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.values)))
+}
+
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription {
+	fds := make([]pgconn.FieldDescription, len(r.columns))
+	for i, column := range r.columns {
+		fds[i] = pgconn.FieldDescription{Name: column}
+	}
+	return fds
+}
+
+func (r *rows) Scan(dest ...any) error {
+	values := r.values[r.pos]
+	if len(dest) != len(values) {
+		return fmt.Errorf("scan: %d destinations for %d columns", len(dest), len(values))
+	}
+	for i, d := range dest {
+		if err := assign(d, values[i]); err != nil {
+			return fmt.Errorf("scan column %q: %w", r.columns[i], err)
+		}
+	}
+	return nil
+}
+
+func (r *rows) Values() ([]any, error) {
+	return r.values[r.pos], nil
+}
+
+func (r *rows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *rows) Conn() *pgx.Conn {
+	return nil
+}
+
+func assign(dest, src any) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(src)
+	}
+	ptr := reflect.ValueOf(dest)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("destination %T is not a pointer", dest)
+	}
+	return assignValue(ptr.Elem(), src)
+}
+
+func assignValue(dv reflect.Value, src any) error {
+	sv := reflect.ValueOf(src)
+	for sv.Kind() == reflect.Pointer && sv.Type() != dv.Type() {
+		if sv.IsNil() {
+			dv.SetZero()
+			return nil
+		}
+		sv = sv.Elem()
+	}
+	if !sv.IsValid() {
+		dv.SetZero()
+		return nil
+	}
+	src = sv.Interface()
+	if dv.Kind() == reflect.Pointer {
+		v := reflect.New(dv.Type().Elem())
+		if err := assignValue(v.Elem(), src); err != nil {
+			return err
+		}
+		dv.Set(v)
+		return nil
+	}
+
+	if sv.Type().AssignableTo(dv.Type()) {
+		dv.Set(sv)
+		return nil
+	}
+	if s, ok := src.(string); ok {
+		return parse(dv, s)
+	}
+	if sv.Kind() != reflect.String && sv.Type().ConvertibleTo(dv.Type()) {
+		dv.Set(sv.Convert(dv.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot assign %T to %s", src, dv.Type())
+}
+
+func parse(dv reflect.Value, s string) error {
+	if dv.Type() == reflect.TypeFor[time.Time]() {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		dv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch dv.Kind() {
+	case reflect.String:
+		dv.SetString(s)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		dv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, dv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, dv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, dv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dv.SetFloat(v)
+	case reflect.Slice:
+		if dv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot parse %q into %s", s, dv.Type())
+		}
+		dv.SetBytes([]byte(s))
+	case reflect.Interface:
+		dv.Set(reflect.ValueOf(s))
+	default:
+		return fmt.Errorf("cannot parse %q into %s", s, dv.Type())
+	}
+	return nil
+}
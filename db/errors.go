@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrForeignKey    = errors.New("foreign key violation")
+	ErrCheck         = errors.New("check violation")
+	ErrSerialization = errors.New("serialization failure")
+	ErrTimeout       = errors.New("timeout")
+	ErrStaleVersion  = errors.New("stale version")
+)
+
+type Error struct {
+	Kind       error
+	Code       string
+	Table      string
+	Constraint string
+	Columns    []string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dbErr *Error
+	if errors.As(err, &dbErr) {
+		return err
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) {
+			return &Error{Kind: ErrTimeout, Err: err}
+		}
+		return err
+	}
+
+	kind := classifyCode(pgErr.Code)
+	if kind == nil {
+		return err
+	}
+
+	e := &Error{
+		Kind:       kind,
+		Code:       pgErr.Code,
+		Table:      pgErr.TableName,
+		Constraint: pgErr.ConstraintName,
+		Err:        err,
+	}
+	if pgErr.ColumnName != "" {
+		e.Columns = []string{pgErr.ColumnName}
+	} else {
+		e.Columns = detailColumns(pgErr.Detail)
+	}
+	return e
+}
+
+func classifyCode(code string) error {
+	switch code {
+	case "23505": // unique_violation
+		return ErrConflict
+	case "23503": // foreign_key_violation
+		return ErrForeignKey
+	case "23514": // check_violation
+		return ErrCheck
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return ErrSerialization
+	case "57014", "55P03": // query_canceled, lock_not_available
+		return ErrTimeout
+	default:
+		return nil
+	}
+}
+
+var detailKeyRe = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+func detailColumns(detail string) []string {
+	match := detailKeyRe.FindStringSubmatch(detail)
+	if match == nil {
+		return nil
+	}
+	columns := strings.Split(match[1], ",")
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+	return columns
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"slices"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	type testCase struct {
+		err     error
+		kind    error
+		columns []string
+	}
+	for _, tc := range []testCase{
+		{err: fmt.Errorf("collect one row: %w", pgx.ErrNoRows), kind: ErrNotFound},
+		{err: &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key", Detail: "Key (tenant_id, email)=(1, a@b.c) already exists."}, kind: ErrConflict, columns: []string{"tenant_id", "email"}},
+		{err: &pgconn.PgError{Code: "23503", Detail: "Key (user_id)=(1) is not present in table \"users\"."}, kind: ErrForeignKey, columns: []string{"user_id"}},
+		{err: &pgconn.PgError{Code: "23514", ColumnName: "age"}, kind: ErrCheck, columns: []string{"age"}},
+		{err: &pgconn.PgError{Code: "40001"}, kind: ErrSerialization},
+		{err: &pgconn.PgError{Code: "57014"}, kind: ErrTimeout},
+		{err: context.DeadlineExceeded, kind: ErrTimeout},
+		{err: &pgconn.PgError{Code: "42601"}},
+	} {
+		err := ClassifyError(tc.err)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v does not wrap %v", err, tc.err)
+		}
+		if tc.kind == nil {
+			if err != tc.err {
+				t.Errorf("%v: unexpected classification %v", tc.err, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tc.kind) {
+			t.Errorf("%v is not %v", err, tc.kind)
+		}
+		var dbErr *Error
+		if !errors.As(err, &dbErr) {
+			t.Fatalf("%v is not *Error", err)
+		}
+		if !slices.Equal(dbErr.Columns, tc.columns) {
+			t.Errorf("columns = %q, want %q", dbErr.Columns, tc.columns)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"github.com/jackc/pgx/v5"
+	"iter"
 )
 
 type ExecFunc[T any] func(ctx context.Context, executor Executor) (T, error)
@@ -22,13 +23,19 @@ type ExecScanner[T any] struct {
 	scan           ExecFunc[[]T]
 	scanOne        ExecFunc[T]
 	scanExactlyOne ExecFunc[T]
+	iter           ExecFunc[iter.Seq2[T, error]]
 }
 
 func NewExecScanner[T any](factory ExecFunc[pgx.Rows]) ExecScanner[T] {
+	return NewExecScannerWith(factory, MapByName[T])
+}
+
+func NewExecScannerWith[T any](factory ExecFunc[pgx.Rows], mapper RowMapper[T]) ExecScanner[T] {
 	return ExecScanner[T]{
-		scan:           ExecWithScanner(factory, Scan[T]),
-		scanOne:        ExecWithScanner(factory, ScanOne[T]),
-		scanExactlyOne: ExecWithScanner(factory, ScanExactlyOne[T]),
+		scan:           ExecWithScanner(factory, ScanWith(mapper)),
+		scanOne:        ExecWithScanner(factory, ScanOneWith(mapper)),
+		scanExactlyOne: ExecWithScanner(factory, ScanExactlyOneWith(mapper)),
+		iter:           ExecWithScanner(factory, ScanIterWith(mapper)),
 	}
 }
 
@@ -43,3 +50,9 @@ func (s ExecScanner[T]) ScanOne(ctx context.Context, executor Executor) (T, erro
 func (s ExecScanner[T]) ScanExactlyOne(ctx context.Context, executor Executor) (T, error) {
 	return s.scanExactlyOne(ctx, executor)
 }
+
+func (s ExecScanner[T]) Iter(ctx context.Context, executor Executor) iter.Seq2[T, error] {
+	return lazyIter(func() (iter.Seq2[T, error], error) {
+		return s.iter(ctx, executor)
+	})
+}
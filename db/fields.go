@@ -0,0 +1,177 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type (
+	field struct {
+		name      string
+		index     []int
+		pk        bool
+		readonly  bool
+		omitempty bool
+		version   bool
+		nested    bool
+	}
+
+	fields []field
+)
+
+var fieldsCache sync.Map
+
+func structFields[T any]() (fields, error) {
+	fs, err := typeFields(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	r := make(fields, 0, len(fs))
+	for _, f := range fs {
+		if !f.nested {
+			r = append(r, f)
+		}
+	}
+	return r, nil
+}
+
+func Columns[T any]() ([]string, error) {
+	fs, err := structFields[T]()
+	if err != nil {
+		return nil, err
+	}
+	return fs.names(), nil
+}
+
+func Values[T any](v T) ([]any, error) {
+	fs, err := structFields[T]()
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.ValueOf(v)
+	values := make([]any, 0, len(fs))
+	for _, f := range fs {
+		values = append(values, f.value(value).Interface())
+	}
+	return values, nil
+}
+
+func typeFields(t reflect.Type) (fields, error) {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.(fields), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	fs := appendFields(nil, t, nil, "")
+	fieldsCache.Store(t, fs)
+	return fs, nil
+}
+
+func appendFields(fs fields, t reflect.Type, index []int, prefix string) fields {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, hasTag := sf.Tag.Lookup("db")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(index[:len(index):len(index)], i)
+		if sf.Anonymous && !hasTag && sf.Type.Kind() == reflect.Struct {
+			fs = appendFields(fs, sf.Type, fieldIndex, prefix)
+			continue
+		}
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		f := field{name: prefix + name, index: fieldIndex, nested: prefix != ""}
+		var container bool
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "pk":
+				f.pk = true
+			case "readonly":
+				f.readonly = true
+			case "omitempty":
+				f.omitempty = true
+			case "version":
+				f.version = true
+			case "nested":
+				if sf.Type.Kind() == reflect.Struct {
+					fs = appendFields(fs, sf.Type, fieldIndex, f.name+".")
+					container = true
+				}
+			}
+		}
+		if container {
+			continue
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (fs fields) names() []string {
+	names := make([]string, 0, len(fs))
+	for _, f := range fs {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+func (fs fields) pk() (field, bool) {
+	for _, f := range fs {
+		if f.pk {
+			return f, true
+		}
+	}
+	for _, f := range fs {
+		if f.name == "id" {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (fs fields) version() (field, bool) {
+	for _, f := range fs {
+		if f.version {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (fs fields) byName(name string) (field, bool) {
+	for _, f := range fs {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func (f field) value(v reflect.Value) reflect.Value {
+	return v.FieldByIndex(f.index)
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bomjdev/yetanother/runner"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
+	"time"
+)
+
+type (
+	HealthOptions struct {
+		Timeout           time.Duration
+		MaxReplicationLag time.Duration
+		MaxSaturation     float64
+	}
+
+	HealthProbe struct {
+		name     string
+		check    func(ctx context.Context) error
+		interval time.Duration
+		mu       sync.RWMutex
+		err      error
+	}
+)
+
+const DefaultHealthInterval = 10 * time.Second
+
+var (
+	ErrUnhealthy  = errors.New("unhealthy")
+	ErrNotChecked = errors.New("health not checked yet")
+)
+
+func HealthCheck(pool *pgxpool.Pool, options HealthOptions) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if options.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+			defer cancel()
+		}
+
+		if err := pool.Ping(ctx); err != nil {
+			return fmt.Errorf("%w: ping: %w", ErrUnhealthy, err)
+		}
+
+		if options.MaxSaturation > 0 {
+			stat := pool.Stat()
+			if saturation := float64(stat.AcquiredConns()) / float64(stat.MaxConns()); saturation > options.MaxSaturation {
+				return fmt.Errorf("%w: pool saturation %.2f exceeds %.2f", ErrUnhealthy, saturation, options.MaxSaturation)
+			}
+		}
+
+		if options.MaxReplicationLag > 0 {
+			var seconds float64
+			if err := pool.QueryRow(ctx, `
+				SELECT CASE WHEN pg_is_in_recovery()
+				THEN coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)::float8
+				ELSE 0 END`,
+			).Scan(&seconds); err != nil {
+				return fmt.Errorf("%w: replication lag: %w", ErrUnhealthy, err)
+			}
+			if lag := time.Duration(seconds * float64(time.Second)); lag > options.MaxReplicationLag {
+				return fmt.Errorf("%w: replication lag %s exceeds %s", ErrUnhealthy, lag, options.MaxReplicationLag)
+			}
+		}
+
+		return nil
+	}
+}
+
+// NewHealthProbe runs check every interval, DefaultHealthInterval when
+// interval is not positive.
+func NewHealthProbe(name string, check func(ctx context.Context) error, interval time.Duration) *HealthProbe {
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	return &HealthProbe{
+		name:     name,
+		check:    check,
+		interval: interval,
+		err:      ErrNotChecked,
+	}
+}
+
+func (p *HealthProbe) Ready() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+func (p *HealthProbe) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		err := p.check(ctx)
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *HealthProbe) RegisterTask(r runner.Runner) {
+	r.AddTask(p.name, &runner.Task{Fn: p.Run})
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthProbe(t *testing.T) {
+	errDown := errors.New("down")
+	checked := make(chan struct{}, 1)
+	probe := NewHealthProbe("db", func(context.Context) error {
+		select {
+		case checked <- struct{}{}:
+		default:
+		}
+		return errDown
+	}, 0)
+	if probe.interval != DefaultHealthInterval {
+		t.Errorf("interval = %s, want %s", probe.interval, DefaultHealthInterval)
+	}
+	if err := probe.Ready(); !errors.Is(err, ErrNotChecked) {
+		t.Errorf("ready before the first check: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- probe.Run(ctx) }()
+	<-checked
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("run = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("probe did not stop")
+	}
+	if err := probe.Ready(); !errors.Is(err, errDown) {
+		t.Errorf("ready = %v", err)
+	}
+}
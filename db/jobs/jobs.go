@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"time"
+)
+
+type (
+	Queue struct {
+		table string
+		dead  string
+	}
+
+	EnqueueOptions struct {
+		RunAt       time.Time
+		Priority    int
+		Key         string
+		MaxAttempts int
+	}
+)
+
+var (
+	ErrDuplicate = errors.New("duplicate job")
+	// ErrLost reports that a job was claimed again by another worker after
+	// its visibility timeout expired, so this worker's outcome is discarded.
+	ErrLost = errors.New("job ownership lost")
+)
+
+// New returns the queue stored in table, which may be schema-qualified.
+func New(table string) Queue {
+	return Queue{
+		table: identifier(table, "").Sanitize(),
+		dead:  identifier(table, "_dead").Sanitize(),
+	}
+}
+
+func Schema(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id           bigserial PRIMARY KEY,
+	kind         text        NOT NULL,
+	payload      jsonb       NOT NULL,
+	priority     integer     NOT NULL DEFAULT 0,
+	run_at       timestamptz NOT NULL DEFAULT now(),
+	locked_until timestamptz,
+	attempts     integer     NOT NULL DEFAULT 0,
+	max_attempts integer     NOT NULL DEFAULT 0,
+	key          text,
+	last_error   text,
+	created_at   timestamptz NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS %[2]s ON %[1]s (key) WHERE key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS %[3]s ON %[1]s (kind, priority DESC, run_at);
+CREATE TABLE IF NOT EXISTS %[4]s (
+	id           bigint      PRIMARY KEY,
+	kind         text        NOT NULL,
+	payload      jsonb       NOT NULL,
+	priority     integer     NOT NULL,
+	attempts     integer     NOT NULL,
+	max_attempts integer     NOT NULL,
+	key          text,
+	last_error   text,
+	created_at   timestamptz NOT NULL,
+	failed_at    timestamptz NOT NULL DEFAULT now()
+)`,
+		identifier(table, "").Sanitize(),
+		pgx.Identifier{unqualified(table) + "_key_idx"}.Sanitize(),
+		pgx.Identifier{unqualified(table) + "_claim_idx"}.Sanitize(),
+		identifier(table, "_dead").Sanitize(),
+	)
+}
+
+// identifier splits a schema-qualified table name and appends suffix to the
+// table part.
+func identifier(table, suffix string) pgx.Identifier {
+	id := pgx.Identifier(strings.Split(table, "."))
+	id[len(id)-1] += suffix
+	return id
+}
+
+// unqualified returns the table part of a name: indexes are created in the
+// schema of their table and cannot be qualified.
+func unqualified(table string) string {
+	return table[strings.LastIndexByte(table, '.')+1:]
+}
+
+func Enqueue[T any](ctx context.Context, executor db.Executor, queue Queue, kind string, payload T, options EnqueueOptions) (int64, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode payload: %w", err)
+	}
+	var runAt any
+	if !options.RunAt.IsZero() {
+		runAt = options.RunAt
+	}
+	var key any
+	if options.Key != "" {
+		key = options.Key
+	}
+	id, err := db.ExecWithScanner(db.GetRows.WithStatement(fmt.Sprintf(`
+		INSERT INTO %s (kind, payload, priority, run_at, key, max_attempts)
+		VALUES ($1, $2, $3, coalesce($4, now()), $5, $6)
+		ON CONFLICT (key) WHERE key IS NOT NULL DO NOTHING
+		RETURNING id`,
+		queue.table,
+	)).WithArgs(kind, body, options.Priority, runAt, key, options.MaxAttempts), db.ScanExactlyOneWith(db.MapScalar[int64]))(db.Unscoped(ctx), executor)
+	if errors.Is(err, db.ErrNotFound) {
+		return 0, fmt.Errorf("%w: %q", ErrDuplicate, options.Key)
+	}
+	return id, err
+}
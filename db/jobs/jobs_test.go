@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/bomjdev/yetanother/db/dbtest"
+	"github.com/bomjdev/yetanother/retry"
+	"strings"
+	"testing"
+	"time"
+)
+
+type payload struct {
+	N int `json:"n"`
+}
+
+func TestQueueIdentifiers(t *testing.T) {
+	q := New("app.jobs")
+	if q.table != `"app"."jobs"` || q.dead != `"app"."jobs_dead"` {
+		t.Errorf("queue tables %s, %s", q.table, q.dead)
+	}
+	schema := Schema("app.jobs")
+	for _, want := range []string{
+		`CREATE TABLE IF NOT EXISTS "app"."jobs" (`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "jobs_key_idx" ON "app"."jobs" (key)`,
+		`CREATE INDEX IF NOT EXISTS "jobs_claim_idx" ON "app"."jobs" (kind`,
+		`CREATE TABLE IF NOT EXISTS "app"."jobs_dead" (`,
+	} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("schema lacks %s", want)
+		}
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	fake := dbtest.NewFake(t).WithMatcher(dbtest.MatchRegexp)
+	runAt := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	fake.ExpectQuery(`(?s)^\s*INSERT INTO "jobs" .*\sON CONFLICT \(key\) WHERE key IS NOT NULL DO NOTHING\s+RETURNING id$`).
+		WithArgs("email", []byte(`{"n":1}`), 5, runAt, "welcome-1", 3).
+		WillReturnRows(dbtest.NewRows("id").AddRow(int64(7)))
+	fake.ExpectQuery(`^\s*INSERT INTO "jobs"`).
+		WithArgs("email", []byte(`{"n":1}`), 0, nil, "welcome-1", 0).
+		WillReturnRows(dbtest.NewRows("id"))
+
+	// Jobs are not scoped data: enqueueing under a scope must not fail.
+	ctx := db.WithScope(context.Background(), db.Scope{"tenant_id": 7})
+	q := New("jobs")
+	id, err := Enqueue(ctx, fake, q, "email", payload{N: 1}, EnqueueOptions{RunAt: runAt, Priority: 5, Key: "welcome-1", MaxAttempts: 3})
+	if err != nil || id != 7 {
+		t.Errorf("enqueue = %d, %v", id, err)
+	}
+	if _, err = Enqueue(ctx, fake, q, "email", payload{N: 1}, EnqueueOptions{Key: "welcome-1"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate enqueue: %v", err)
+	}
+	if err = fake.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func newTestWorker(fake *dbtest.Fake, handler func(context.Context, payload) error) *Worker[payload] {
+	return NewWorker("worker", fake, New("jobs"), "email", handler, WorkerOptions{
+		Visibility:  time.Minute,
+		MaxAttempts: 3,
+		Delay:       retry.DelayOptions{Delay: time.Second, Func: retry.DoubleDelay},
+	})
+}
+
+func expectClaim(fake *dbtest.Fake, body string, attempts, maxAttempts int) {
+	rows := dbtest.NewRows("id", "payload", "attempts", "max_attempts")
+	if body != "" {
+		rows.AddRow(int64(1), []byte(body), attempts, maxAttempts)
+	}
+	fake.ExpectQuery(`(?s)^\s*UPDATE "jobs" SET attempts = attempts \+ 1.*FOR UPDATE SKIP LOCKED`).
+		WithArgs("email", int64(60000)).
+		WillReturnRows(rows)
+}
+
+func TestWorker(t *testing.T) {
+	errHandle := errors.New("smtp down")
+	bury := `(?s)^\s*WITH moved AS \(DELETE FROM "jobs" WHERE id = \$1 AND attempts = \$2 RETURNING \*\)\s+INSERT INTO "jobs_dead"`
+	reschedule := `(?s)^\s*UPDATE "jobs" SET run_at = .*\sWHERE id = \$1 AND attempts = \$2$`
+
+	type testCase struct {
+		name      string
+		setup     func(fake *dbtest.Fake)
+		handle    error
+		completed bool
+		handled   bool
+		err       error
+	}
+	for _, tc := range []testCase{
+		{
+			name:  "empty queue",
+			setup: func(fake *dbtest.Fake) { expectClaim(fake, "", 0, 0) },
+		},
+		{
+			name: "complete",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":1}`, 1, 0)
+				fake.ExpectExec(`^DELETE FROM "jobs" WHERE id = \$1 AND attempts = \$2$`).WithArgs(int64(1), 1).WillReturnResult("DELETE 1")
+			},
+			completed: true,
+			handled:   true,
+		},
+		{
+			name: "retry with backoff",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":1}`, 2, 0)
+				fake.ExpectExec(reschedule).WithArgs(int64(1), 2, int64(2000), errHandle.Error()).WillReturnResult("UPDATE 1")
+			},
+			handle:  errHandle,
+			handled: true,
+		},
+		{
+			name: "bury after max attempts",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":1}`, 3, 0)
+				fake.ExpectExec(bury).WithArgs(int64(1), 3, errHandle.Error()).WillReturnResult("INSERT 0 1")
+			},
+			handle:  errHandle,
+			handled: true,
+		},
+		{
+			name: "job max attempts",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":1}`, 1, 1)
+				fake.ExpectExec(bury).WithArgs(int64(1), 1, errHandle.Error()).WillReturnResult("INSERT 0 1")
+			},
+			handle:  errHandle,
+			handled: true,
+		},
+		{
+			name: "bury undecodable payload",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":"x"}`, 1, 0)
+				fake.ExpectExec(bury).WillReturnResult("INSERT 0 1")
+			},
+		},
+		{
+			name: "lost while completing",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":1}`, 1, 0)
+				fake.ExpectExec(`^DELETE FROM "jobs"`).WithArgs(int64(1), 1).WillReturnResult("DELETE 0")
+			},
+			handled: true,
+			err:     ErrLost,
+		},
+		{
+			name: "lost while rescheduling",
+			setup: func(fake *dbtest.Fake) {
+				expectClaim(fake, `{"n":1}`, 1, 0)
+				fake.ExpectExec(reschedule).WithArgs(int64(1), 1, int64(1000), errHandle.Error()).WillReturnResult("UPDATE 0")
+			},
+			handle:  errHandle,
+			handled: true,
+			err:     ErrLost,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := dbtest.NewFake(t).WithMatcher(dbtest.MatchRegexp)
+			tc.setup(fake)
+			var handled []payload
+			w := newTestWorker(fake, func(_ context.Context, p payload) error {
+				handled = append(handled, p)
+				return tc.handle
+			})
+			completed, err := w.work(context.Background())
+			if completed != tc.completed || !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+				t.Errorf("work = %t, %v; want %t, %v", completed, err, tc.completed, tc.err)
+			}
+			if tc.handled != (len(handled) == 1) || tc.handled && handled[0].N != 1 {
+				t.Errorf("handled %v", handled)
+			}
+			if err = fake.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWorkerFailingJob(t *testing.T) {
+	errHandle := errors.New("smtp down")
+	fake := dbtest.NewFake(t).WithMatcher(dbtest.MatchRegexp)
+	expectClaim(fake, `{"n":1}`, 1, 0)
+	fake.ExpectExec(`(?s)^\s*UPDATE "jobs" SET run_at = `).WithArgs(int64(1), 1, int64(1000), errHandle.Error()).WillReturnResult("UPDATE 1")
+	expectClaim(fake, `{"n":1}`, defaultMaxAttempts, 0)
+	fake.ExpectExec(`(?s)^\s*WITH moved AS`).WithArgs(int64(1), defaultMaxAttempts, errHandle.Error()).WillReturnResult("INSERT 0 1")
+
+	const pollInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []time.Time
+	w := NewWorker("worker", fake, New("jobs"), "email", func(context.Context, payload) error {
+		calls = append(calls, time.Now())
+		if len(calls) == 2 {
+			cancel()
+		}
+		return errHandle
+	}, WorkerOptions{PollInterval: pollInterval, Visibility: time.Minute})
+	if err := w.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v", err)
+	}
+	if len(calls) != 2 || calls[1].Sub(calls[0]) < pollInterval/2 {
+		t.Errorf("failing job claimed again without waiting: %v", calls)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
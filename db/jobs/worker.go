@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bomjdev/yetanother/db"
+	"github.com/bomjdev/yetanother/mq"
+	"github.com/bomjdev/yetanother/retry"
+	"github.com/bomjdev/yetanother/runner"
+	"github.com/jackc/pgx/v5/pgconn"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultMaxAttempts = 10
+
+type (
+	WorkerOptions struct {
+		Concurrency  int
+		PollInterval time.Duration
+		Visibility   time.Duration
+		MaxAttempts  int
+		Delay        retry.DelayOptions
+	}
+
+	Worker[T any] struct {
+		name     string
+		executor db.Executor
+		queue    Queue
+		kind     string
+		handler  mq.Handler[T]
+		options  WorkerOptions
+	}
+
+	job struct {
+		ID          int64  `db:"id"`
+		Payload     []byte `db:"payload"`
+		Attempts    int    `db:"attempts"`
+		MaxAttempts int    `db:"max_attempts"`
+	}
+)
+
+func NewWorker[T any](name string, executor db.Executor, queue Queue, kind string, handler mq.Handler[T], options WorkerOptions) *Worker[T] {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+	if options.Visibility <= 0 {
+		options.Visibility = 5 * time.Minute
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultMaxAttempts
+	}
+	if options.Delay.Delay <= 0 {
+		options.Delay = retry.DelayOptions{Delay: time.Second, Func: retry.DoubleDelay, Max: time.Hour}
+	}
+	return &Worker[T]{
+		name:     name,
+		executor: executor,
+		queue:    queue,
+		kind:     kind,
+		handler:  handler,
+		options:  options,
+	}
+}
+
+func (w *Worker[T]) RegisterTask(r runner.Runner) {
+	r.AddTask(w.name, &runner.Task{Fn: w.Run})
+}
+
+func (w *Worker[T]) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range w.options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (w *Worker[T]) loop(ctx context.Context) {
+	ticker := time.NewTicker(w.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		completed, err := w.work(ctx)
+		if err != nil {
+			log.Printf("worker %q: %s", w.name, err)
+		}
+		// Only a completed job suggests more are ready: a failed one is
+		// rescheduled, and claiming again at once would spin on it.
+		if completed {
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// work claims and handles a job, reporting whether one was completed.
+func (w *Worker[T]) work(ctx context.Context) (bool, error) {
+	j, err := db.ExecWithScanner(db.GetRows.WithStatement(fmt.Sprintf(`
+		UPDATE %[1]s SET attempts = attempts + 1, locked_until = now() + $2 * interval '1 millisecond'
+		WHERE id = (
+			SELECT id FROM %[1]s
+			WHERE kind = $1 AND run_at <= now() AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY priority DESC, run_at, id
+			LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, payload, attempts, max_attempts`,
+		w.queue.table,
+	)).WithArgs(w.kind, w.options.Visibility.Milliseconds()), db.ScanOne[job])(ctx, w.executor)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim: %w", err)
+	}
+
+	if err = w.handle(ctx, j); err != nil {
+		return false, w.fail(ctx, j, err)
+	}
+	tag, err := db.Exec(ctx, w.executor, fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND attempts = $2", w.queue.table), j.ID, j.Attempts)
+	if err = owned(tag, err); err != nil {
+		return false, fmt.Errorf("complete %d: %w", j.ID, err)
+	}
+	return true, nil
+}
+
+func (w *Worker[T]) handle(ctx context.Context, j job) error {
+	var v T
+	if err := json.Unmarshal(j.Payload, &v); err != nil {
+		return fmt.Errorf("%w: decode payload: %w", retry.ErrStop, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.options.Visibility)
+	defer cancel()
+	return w.handler(ctx, v)
+}
+
+func (w *Worker[T]) fail(ctx context.Context, j job, cause error) error {
+	log.Printf("worker %q: job %d attempt %d: %s", w.name, j.ID, j.Attempts, cause)
+	maxAttempts := j.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = w.options.MaxAttempts
+	}
+	if errors.Is(cause, retry.ErrStop) || maxAttempts > 0 && j.Attempts >= maxAttempts {
+		tag, err := db.Exec(ctx, w.executor, fmt.Sprintf(`
+			WITH moved AS (DELETE FROM %s WHERE id = $1 AND attempts = $2 RETURNING *)
+			INSERT INTO %s (id, kind, payload, priority, attempts, max_attempts, key, last_error, created_at)
+			SELECT id, kind, payload, priority, attempts, max_attempts, key, $3, created_at FROM moved`,
+			w.queue.table, w.queue.dead,
+		), j.ID, j.Attempts, cause.Error())
+		if err = owned(tag, err); err != nil {
+			return fmt.Errorf("bury %d: %w", j.ID, err)
+		}
+		return nil
+	}
+	tag, err := db.Exec(ctx, w.executor, fmt.Sprintf(`
+		UPDATE %s SET run_at = now() + $3 * interval '1 millisecond', locked_until = NULL, last_error = $4
+		WHERE id = $1 AND attempts = $2`,
+		w.queue.table,
+	), j.ID, j.Attempts, w.options.Delay.Attempt(uint(j.Attempts)).Milliseconds(), cause.Error())
+	if err = owned(tag, err); err != nil {
+		return fmt.Errorf("reschedule %d: %w", j.ID, err)
+	}
+	return nil
+}
+
+// owned fails with ErrLost when a statement fenced on the claimed attempt
+// matched no row.
+func owned(tag pgconn.CommandTag, err error) error {
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrLost
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bomjdev/yetanother/mq"
+	"github.com/bomjdev/yetanother/retry"
+	"github.com/bomjdev/yetanother/runner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log"
+	"time"
+)
+
+type (
+	NotificationHandler mq.Handler[*pgconn.Notification]
+
+	Listener struct {
+		name     string
+		config   *pgx.ConnConfig
+		retry    retry.Retry
+		handlers map[string]NotificationHandler
+	}
+)
+
+var ErrNoChannels = errors.New("no channels to listen")
+
+// NewListener listens on connections configured like pool. retry governs
+// reconnecting: it is applied afresh after every lost connection, and
+// defaults to a delay doubling from one second to one minute when nil.
+func NewListener(name string, pool *pgxpool.Pool, retry retry.Retry) *Listener {
+	if retry == nil {
+		retry = defaultRetry()
+	}
+	return &Listener{
+		name:     name,
+		config:   pool.Config().ConnConfig,
+		retry:    retry,
+		handlers: make(map[string]NotificationHandler),
+	}
+}
+
+func (l *Listener) Handle(channel string, handler NotificationHandler) {
+	l.handlers[channel] = handler
+}
+
+func ListenJSON[T any](l *Listener, channel string, handler mq.Handler[T]) {
+	l.Handle(channel, func(ctx context.Context, notification *pgconn.Notification) error {
+		var v T
+		if err := json.Unmarshal([]byte(notification.Payload), &v); err != nil {
+			return fmt.Errorf("decode %q payload: %w", notification.Channel, err)
+		}
+		return handler(ctx, v)
+	})
+}
+
+func (l *Listener) Listen(ctx context.Context) error {
+	if len(l.handlers) == 0 {
+		return ErrNoChannels
+	}
+	for {
+		conn, err := l.subscribe(ctx)
+		if err != nil {
+			return err
+		}
+		err = l.receive(ctx, conn)
+		_ = conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("listener %q: %s", l.name, err)
+	}
+}
+
+// subscribe connects and listens on every channel, retrying until it succeeds
+// or the retry gives up.
+func (l *Listener) subscribe(ctx context.Context) (*pgx.Conn, error) {
+	var conn *pgx.Conn
+	err := l.retry(ctx, func(ctx context.Context) error {
+		var err error
+		conn, err = l.listen(ctx)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", retry.ErrStop, ctx.Err())
+		}
+		if err != nil {
+			log.Printf("listener %q: %s", l.name, err)
+		}
+		return err
+	})
+	return conn, err
+}
+
+func (l *Listener) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, l.config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	for channel := range l.handlers {
+		if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			_ = conn.Close(context.Background())
+			return nil, fmt.Errorf("listen %q: %w", channel, err)
+		}
+	}
+	return conn, nil
+}
+
+func (l *Listener) receive(ctx context.Context, conn *pgx.Conn) error {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		l.dispatch(ctx, notification)
+	}
+}
+
+func (l *Listener) dispatch(ctx context.Context, notification *pgconn.Notification) {
+	handler, ok := l.handlers[notification.Channel]
+	if !ok {
+		log.Printf("listener %q: unknown channel %q", l.name, notification.Channel)
+		return
+	}
+	if err := handler(ctx, notification); err != nil {
+		log.Printf("listener %q: handle %q: %s", l.name, notification.Channel, err)
+	}
+}
+
+func (l *Listener) RegisterTask(r runner.Runner) {
+	r.AddTask(l.name, &runner.Task{Fn: l.Listen})
+}
+
+var defaultDelay = retry.DelayOptions{Delay: time.Second, Func: retry.DoubleDelay, Max: time.Minute}
+
+func defaultRetry() retry.Retry {
+	return retry.New(retry.Delay(defaultDelay))
+}
+
+func Notify(ctx context.Context, executor Executor, channel, payload string) error {
+	_, err := Exec(Unscoped(ctx), executor, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+func NotifyJSON[T any](ctx context.Context, executor Executor, channel string, v T) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode payload: %w", err)
+	}
+	return Notify(ctx, executor, channel, string(payload))
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/retry"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+	"time"
+)
+
+func TestListenJSON(t *testing.T) {
+	type event struct {
+		ID   int    `json:"id"`
+		Kind string `json:"kind"`
+	}
+	l := NewListener("events", newTestPool(t, "localhost"), nil)
+	if l.retry == nil {
+		t.Fatal("no default retry")
+	}
+	var got []event
+	ListenJSON(l, "events", func(_ context.Context, e event) error {
+		got = append(got, e)
+		return nil
+	})
+
+	ctx := context.Background()
+	l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `{"id":1,"kind":"created"}`})
+	l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `not json`})
+	l.dispatch(ctx, &pgconn.Notification{Channel: "other", Payload: `{"id":2}`})
+	if len(got) != 1 || got[0] != (event{ID: 1, Kind: "created"}) {
+		t.Errorf("handled %+v", got)
+	}
+}
+
+func TestListenUnreachable(t *testing.T) {
+	if err := NewListener("none", newTestPool(t, "localhost"), nil).Listen(context.Background()); !errors.Is(err, ErrNoChannels) {
+		t.Errorf("listen without channels: %v", err)
+	}
+
+	l := NewListener("events", newTestPoolPort(t, "127.0.0.1", 1), retry.New(retry.MaxAttempts(2)))
+	l.Handle("events", func(context.Context, *pgconn.Notification) error { return nil })
+	if err := l.Listen(context.Background()); !errors.Is(err, retry.ErrStop) {
+		t.Errorf("listen on an unreachable host: %v", err)
+	}
+
+	l.retry = retry.New(retry.Delay(retry.DelayOptions{Delay: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Listen(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("listen after the context expired: %v", err)
+	}
+}
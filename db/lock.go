@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bomjdev/yetanother/retry"
+	"github.com/bomjdev/yetanother/runner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"hash/fnv"
+	"log"
+	"time"
+)
+
+type (
+	LeaderOptions struct {
+		Interval time.Duration
+	}
+
+	Leader struct {
+		name    string
+		config  *pgx.ConnConfig
+		key     string
+		task    *runner.Task
+		retry   retry.Retry
+		options LeaderOptions
+	}
+)
+
+func LockKey(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// Session-scoped locks belong to the connection that took them, so executor
+// must be a single connection (*pgx.Conn, *pgxpool.Conn or pgx.Tx), not a pool.
+// Lock helpers always run on the primary, as a replica cannot take locks, and
+// outside any scope, as lock keys are not scoped data.
+func AdvisoryLock(ctx context.Context, executor Executor, key string) error {
+	_, err := Exec(Unscoped(WithPrimary(ctx)), executor, "SELECT pg_advisory_lock($1)", LockKey(key))
+	return err
+}
+
+func TryAdvisoryLock(ctx context.Context, executor Executor, key string) (bool, error) {
+	return queryBool(ctx, executor, "SELECT pg_try_advisory_lock($1)", LockKey(key))
+}
+
+func AdvisoryUnlock(ctx context.Context, executor Executor, key string) (bool, error) {
+	return queryBool(ctx, executor, "SELECT pg_advisory_unlock($1)", LockKey(key))
+}
+
+func AdvisoryXactLock(ctx context.Context, tx Executor, key string) error {
+	_, err := Exec(Unscoped(WithPrimary(ctx)), tx, "SELECT pg_advisory_xact_lock($1)", LockKey(key))
+	return err
+}
+
+func TryAdvisoryXactLock(ctx context.Context, tx Executor, key string) (bool, error) {
+	return queryBool(ctx, tx, "SELECT pg_try_advisory_xact_lock($1)", LockKey(key))
+}
+
+func queryBool(ctx context.Context, executor Executor, stmt string, args ...any) (bool, error) {
+	var ok bool
+	if err := executor.QueryRow(WithPrimary(ctx), stmt, args...).Scan(&ok); err != nil {
+		return false, ClassifyError(err)
+	}
+	return ok, nil
+}
+
+// NewLeader runs task while holding the advisory lock key on a connection
+// configured like pool. retry governs acquiring the lock: it is applied afresh
+// after every lost leadership, and defaults to a delay doubling from one
+// second to one minute when nil.
+func NewLeader(name string, pool *pgxpool.Pool, key string, task *runner.Task, retry retry.Retry, options LeaderOptions) *Leader {
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Second
+	}
+	if retry == nil {
+		retry = defaultRetry()
+	}
+	return &Leader{
+		name:    name,
+		config:  pool.Config().ConnConfig,
+		key:     key,
+		task:    task,
+		retry:   retry,
+		options: options,
+	}
+}
+
+func (l *Leader) RegisterTask(r runner.Runner) {
+	r.AddTask(l.name, &runner.Task{Fn: l.Run})
+}
+
+func (l *Leader) Run(ctx context.Context) error {
+	for {
+		conn, err := l.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		err = l.hold(ctx, conn)
+		_ = conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			return nil
+		}
+		log.Printf("leader %q: %s", l.name, err)
+		select {
+		case <-time.After(l.options.Interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// acquire returns a connection holding the lock, retrying connection failures
+// until the retry gives up. Waiting for another leader to let go is not a
+// failure.
+func (l *Leader) acquire(ctx context.Context) (*pgx.Conn, error) {
+	var conn *pgx.Conn
+	err := l.retry(ctx, func(ctx context.Context) error {
+		var err error
+		conn, err = l.lock(ctx)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", retry.ErrStop, ctx.Err())
+		}
+		if err != nil {
+			log.Printf("leader %q: %s", l.name, err)
+		}
+		return err
+	})
+	return conn, err
+}
+
+func (l *Leader) lock(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, l.config)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	ticker := time.NewTicker(l.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := TryAdvisoryLock(ctx, conn, l.key)
+		if err != nil {
+			_ = conn.Close(context.Background())
+			return nil, fmt.Errorf("try lock: %w", err)
+		}
+		if ok {
+			log.Printf("leader %q: acquired %q", l.name, l.key)
+			return conn, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			_ = conn.Close(context.Background())
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *Leader) hold(ctx context.Context, conn *pgx.Conn) error {
+	ticker := time.NewTicker(l.options.Interval)
+	defer ticker.Stop()
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- l.task.Fn(taskCtx)
+	}()
+
+	stop := func(cause error) error {
+		if l.task.Shutdown != nil {
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), l.options.Interval)
+			defer cancelShutdown()
+			if err := l.task.Shutdown(shutdownCtx); err != nil {
+				cause = errors.Join(cause, fmt.Errorf("shutdown: %w", err))
+			}
+		}
+		cancel()
+		<-done
+		log.Printf("leader %q: released %q", l.name, l.key)
+		return cause
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if _, unlockErr := AdvisoryUnlock(context.Background(), conn, l.key); unlockErr != nil {
+				err = errors.Join(err, fmt.Errorf("unlock: %w", unlockErr))
+			}
+			return err
+		case <-ticker.C:
+			if err := conn.Ping(ctx); err != nil {
+				return stop(fmt.Errorf("connection lost: %w", err))
+			}
+		case <-ctx.Done():
+			return stop(ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/retry"
+	"github.com/bomjdev/yetanother/runner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+// primaryExecutor records whether each statement was pinned to the primary.
+type primaryExecutor struct {
+	fakeExecutor
+	pinned []bool
+}
+
+func (e *primaryExecutor) record(ctx context.Context) {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	e.pinned = append(e.pinned, primary)
+}
+
+func (e *primaryExecutor) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	e.record(ctx)
+	return e.fakeExecutor.Exec(ctx, sql, args...)
+}
+
+func (e *primaryExecutor) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	e.record(ctx)
+	return e.fakeExecutor.Query(ctx, sql, args...)
+}
+
+func (e *primaryExecutor) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	e.record(ctx)
+	return e.fakeExecutor.QueryRow(ctx, sql, args...)
+}
+
+func TestLockHelpersUsePrimary(t *testing.T) {
+	executor := &primaryExecutor{fakeExecutor: fakeExecutor{results: []*fakeRows{
+		newFakeRows([]string{"ok"}, []any{true}),
+		newFakeRows([]string{"ok"}, []any{true}),
+		newFakeRows([]string{"ok"}, []any{false}),
+	}}}
+	ctx := WithReplica(context.Background())
+	if err := AdvisoryLock(ctx, executor, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := TryAdvisoryLock(ctx, executor, "jobs"); err != nil || !ok {
+		t.Errorf("try lock = %t, %v", ok, err)
+	}
+	if ok, err := AdvisoryUnlock(ctx, executor, "jobs"); err != nil || !ok {
+		t.Errorf("unlock = %t, %v", ok, err)
+	}
+	if err := AdvisoryXactLock(ctx, executor, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := TryAdvisoryXactLock(ctx, executor, "jobs"); err != nil || ok {
+		t.Errorf("try xact lock = %t, %v", ok, err)
+	}
+	if len(executor.pinned) != 5 {
+		t.Fatalf("ran %d statements", len(executor.pinned))
+	}
+	for i, pinned := range executor.pinned {
+		if !pinned {
+			t.Errorf("statement %d (%s) not pinned to the primary", i, executor.stmts[i].sql)
+		}
+	}
+	if executor.stmts[0].args[0] != LockKey("jobs") {
+		t.Errorf("lock key = %v", executor.stmts[0].args[0])
+	}
+}
+
+func TestLockHelpersScoped(t *testing.T) {
+	executor := &fakeExecutor{}
+	ctx := WithScope(context.Background(), Scope{"tenant_id": 7})
+	if err := AdvisoryLock(ctx, executor, "jobs"); err != nil {
+		t.Errorf("lock: %v", err)
+	}
+	if err := AdvisoryXactLock(ctx, executor, "jobs"); err != nil {
+		t.Errorf("xact lock: %v", err)
+	}
+	if len(executor.stmts) != 2 {
+		t.Errorf("statements = %v", executor.stmts)
+	}
+}
+
+func TestLeaderUnreachable(t *testing.T) {
+	var ran bool
+	task := &runner.Task{Fn: func(context.Context) error {
+		ran = true
+		return nil
+	}}
+	if l := NewLeader("cron", newTestPool(t, "localhost"), "cron", task, nil, LeaderOptions{}); l.retry == nil {
+		t.Error("no default retry")
+	}
+	l := NewLeader("cron", newTestPoolPort(t, "127.0.0.1", 1), "cron", task, retry.New(retry.MaxAttempts(2)), LeaderOptions{})
+	if err := l.Run(context.Background()); !errors.Is(err, retry.ErrStop) {
+		t.Errorf("run on an unreachable host: %v", err)
+	}
+	if ran {
+		t.Error("task ran without the lock")
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"reflect"
+)
+
+type RowMapper[T any] func(row pgx.CollectableRow) (T, error)
+
+func MapByName[T any](row pgx.CollectableRow) (T, error) {
+	return pgx.RowToStructByName[T](row)
+}
+
+func MapByNameLax[T any](row pgx.CollectableRow) (T, error) {
+	return pgx.RowToStructByNameLax[T](row)
+}
+
+func MapByPos[T any](row pgx.CollectableRow) (T, error) {
+	return pgx.RowToStructByPos[T](row)
+}
+
+func MapScalar[T any](row pgx.CollectableRow) (T, error) {
+	return pgx.RowTo[T](row)
+}
+
+func MapMap(row pgx.CollectableRow) (map[string]any, error) {
+	return pgx.RowToMap(row)
+}
+
+func MapAddrOfStruct[T any](row pgx.CollectableRow) (*T, error) {
+	return pgx.RowToAddrOfStructByName[T](row)
+}
+
+// MapNested maps columns aliased as "prefix.column" onto struct fields tagged
+// `db:"prefix,nested"`, so JOIN results can be scanned into composed structs.
+// Struct fields without a matching column are left zero.
+func MapNested[T any](row pgx.CollectableRow) (T, error) {
+	var v T
+	fs, err := typeFields(reflect.TypeFor[T]())
+	if err != nil {
+		return v, err
+	}
+	value := reflect.ValueOf(&v).Elem()
+	descriptions := row.FieldDescriptions()
+	targets := make([]any, 0, len(descriptions))
+	for _, description := range descriptions {
+		f, ok := fs.byName(description.Name)
+		if !ok {
+			return v, fmt.Errorf("%s has no field for column %q", value.Type(), description.Name)
+		}
+		targets = append(targets, f.value(value).Addr().Interface())
+	}
+	return v, row.Scan(targets...)
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"reflect"
+	"testing"
+)
+
+type fakeRow struct {
+	columns []string
+	values  []any
+}
+
+func (r fakeRow) FieldDescriptions() []pgconn.FieldDescription {
+	descriptions := make([]pgconn.FieldDescription, 0, len(r.columns))
+	for _, column := range r.columns {
+		descriptions = append(descriptions, pgconn.FieldDescription{Name: column})
+	}
+	return descriptions
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(r.values) {
+		return fmt.Errorf("scan %d values into %d targets", len(r.values), len(dest))
+	}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+func (r fakeRow) Values() ([]any, error) {
+	return r.values, nil
+}
+
+func (r fakeRow) RawValues() [][]byte {
+	return nil
+}
+
+func TestMapNested(t *testing.T) {
+	type (
+		user struct {
+			ID   int64  `db:"id"`
+			Name string `db:"name"`
+		}
+		order struct {
+			ID    int64 `db:"id"`
+			Total int64
+			User  user `db:"u,nested"`
+		}
+	)
+
+	v, err := MapNested[order](fakeRow{
+		columns: []string{"id", "total", "u.id", "u.name"},
+		values:  []any{int64(1), int64(100), int64(2), "bob"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := order{ID: 1, Total: 100, User: user{ID: 2, Name: "bob"}}
+	if v != want {
+		t.Errorf("got %+v, want %+v", v, want)
+	}
+
+	if _, err = MapNested[order](fakeRow{columns: []string{"unknown"}, values: []any{1}}); err == nil {
+		t.Error("expected error for unknown column")
+	}
+
+	fs, err := structFields[order]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := fs.names(); !reflect.DeepEqual(names, []string{"id", "total"}) {
+		t.Errorf("write columns = %q", names)
+	}
+}
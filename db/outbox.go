@@ -0,0 +1,449 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bomjdev/yetanother/mq"
+	"github.com/bomjdev/yetanother/retry"
+	"github.com/bomjdev/yetanother/runner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
+	"time"
+)
+
+type (
+	Outbox struct {
+		table   string
+		channel string
+	}
+
+	RelayOptions struct {
+		BatchSize    int
+		PollInterval time.Duration
+		MaxAttempts  int
+		Delay        retry.DelayOptions
+	}
+
+	OutboxRelay struct {
+		name      string
+		db        Beginner
+		outbox    Outbox
+		producers map[string]mq.RawProducer
+		options   RelayOptions
+		wake      chan struct{}
+	}
+
+	outboxRow struct {
+		ID         int64  `db:"id"`
+		Exchange   string `db:"exchange"`
+		RoutingKey string `db:"routing_key"`
+		Properties []byte `db:"properties"`
+		Headers    []byte `db:"headers"`
+		Body       []byte `db:"body"`
+		Attempts   int    `db:"attempts"`
+	}
+
+	// outboxProperties holds the amqp.Publishing properties besides headers
+	// and body.
+	outboxProperties struct {
+		ContentType     string     `json:"content_type,omitempty"`
+		ContentEncoding string     `json:"content_encoding,omitempty"`
+		DeliveryMode    uint8      `json:"delivery_mode,omitempty"`
+		Priority        uint8      `json:"priority,omitempty"`
+		CorrelationId   string     `json:"correlation_id,omitempty"`
+		ReplyTo         string     `json:"reply_to,omitempty"`
+		Expiration      string     `json:"expiration,omitempty"`
+		MessageId       string     `json:"message_id,omitempty"`
+		Timestamp       *time.Time `json:"timestamp,omitempty"`
+		Type            string     `json:"type,omitempty"`
+		UserId          string     `json:"user_id,omitempty"`
+		AppId           string     `json:"app_id,omitempty"`
+	}
+
+	// headerValue is an AMQP table value tagged with its Go type, so that
+	// headers survive the JSON round trip with the types they were given.
+	headerValue struct {
+		Type  string          `json:"t"`
+		Value json.RawMessage `json:"v,omitempty"`
+	}
+)
+
+// NewOutbox stores messages in table and notifies channel, the table name when
+// empty, on every publish.
+func NewOutbox(table, channel string) Outbox {
+	if channel == "" {
+		channel = table
+	}
+	return Outbox{table: identifier(table).Sanitize(), channel: channel}
+}
+
+func OutboxSchema(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id           bigserial PRIMARY KEY,
+	exchange     text        NOT NULL,
+	routing_key  text        NOT NULL,
+	properties   jsonb       NOT NULL DEFAULT '{}',
+	headers      jsonb,
+	body         bytea       NOT NULL,
+	attempts     integer     NOT NULL DEFAULT 0,
+	last_error   text,
+	created_at   timestamptz NOT NULL DEFAULT now(),
+	available_at timestamptz NOT NULL DEFAULT now(),
+	sent_at      timestamptz,
+	dead_at      timestamptz
+)`, identifier(table).Sanitize())
+}
+
+func (o Outbox) Publish(ctx context.Context, executor Executor, exchange, routingKey string, msg amqp.Publishing) error {
+	properties, err := json.Marshal(newOutboxProperties(msg))
+	if err != nil {
+		return fmt.Errorf("encode properties: %w", err)
+	}
+	headers, err := encodeHeaders(msg.Headers)
+	if err != nil {
+		return fmt.Errorf("encode headers: %w", err)
+	}
+	// Outbox rows belong to no scope, even when published on behalf of one.
+	ctx = Unscoped(ctx)
+	if _, err = Exec(ctx, executor, fmt.Sprintf(
+		"INSERT INTO %s (exchange, routing_key, properties, headers, body) VALUES ($1, $2, $3, $4, $5)",
+		o.table,
+	), exchange, routingKey, properties, headers, msg.Body); err != nil {
+		return fmt.Errorf("outbox insert: %w", err)
+	}
+	return Notify(ctx, executor, o.channel, "")
+}
+
+func OutboxJSON[T any](outbox Outbox, fallback Executor, exchange string) mq.ProducerFuncWithKey[T] {
+	return func(ctx context.Context, v T, routingKey string) error {
+		body, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return outbox.Publish(ctx, ExecutorFrom(ctx, fallback), exchange, routingKey, amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		})
+	}
+}
+
+func NewOutboxRelay(name string, db Beginner, outbox Outbox, producers map[string]mq.RawProducer, options RelayOptions) *OutboxRelay {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+	if options.Delay.Delay <= 0 {
+		options.Delay = defaultDelay
+	}
+	return &OutboxRelay{
+		name:      name,
+		db:        db,
+		outbox:    outbox,
+		producers: producers,
+		options:   options,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+func (r *OutboxRelay) Wake(listener *Listener) {
+	listener.Handle(r.outbox.channel, func(context.Context, *pgconn.Notification) error {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		sent, err := r.relay(ctx)
+		if err != nil {
+			log.Printf("outbox relay %q: %s", r.name, err)
+		}
+		// Only a full batch of sent rows suggests more are ready: failed rows
+		// wait for their delay.
+		if err == nil && sent == r.options.BatchSize {
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-r.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *OutboxRelay) RegisterTask(run runner.Runner) {
+	run.AddTask(r.name, &runner.Task{Fn: r.Run})
+}
+
+// relay publishes a batch of rows and returns how many were sent.
+func (r *OutboxRelay) relay(ctx context.Context) (int, error) {
+	var sent int
+	err := RunInTransaction(ctx, r.db, func(tx pgx.Tx) error {
+		rows, err := ExecWithScanner(GetRows.WithStatement(fmt.Sprintf(`
+			SELECT id, exchange, routing_key, properties, headers, body, attempts FROM %s
+			WHERE sent_at IS NULL AND dead_at IS NULL AND available_at <= now()
+			ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`,
+			r.outbox.table,
+		)).WithArgs(r.options.BatchSize), Scan[outboxRow])(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("claim: %w", err)
+		}
+		sent = 0
+		for _, row := range rows {
+			if err = r.publish(ctx, row); err != nil {
+				err = r.fail(ctx, tx, row, err)
+			} else if _, err = Exec(ctx, tx, fmt.Sprintf("UPDATE %s SET sent_at = now() WHERE id = $1", r.outbox.table), row.ID); err == nil {
+				sent++
+			}
+			if err != nil {
+				return fmt.Errorf("update %d: %w", row.ID, err)
+			}
+		}
+		return nil
+	})
+	return sent, err
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, row outboxRow) error {
+	produce, ok := r.producers[row.Exchange]
+	if !ok {
+		return fmt.Errorf("no producer for exchange %q", row.Exchange)
+	}
+	msg, err := row.publishing()
+	if err != nil {
+		return err
+	}
+	return produce(ctx, msg, row.RoutingKey)
+}
+
+func (r *OutboxRelay) fail(ctx context.Context, tx pgx.Tx, row outboxRow, cause error) error {
+	attempts := row.Attempts + 1
+	log.Printf("outbox relay %q: publish %d attempt %d: %s", r.name, row.ID, attempts, cause)
+	if r.options.MaxAttempts > 0 && attempts >= r.options.MaxAttempts {
+		_, err := Exec(ctx, tx, fmt.Sprintf(
+			"UPDATE %s SET attempts = $2, last_error = $3, dead_at = now() WHERE id = $1",
+			r.outbox.table,
+		), row.ID, attempts, cause.Error())
+		return err
+	}
+	_, err := Exec(ctx, tx, fmt.Sprintf(
+		"UPDATE %s SET attempts = $2, last_error = $3, available_at = now() + $4 * interval '1 millisecond' WHERE id = $1",
+		r.outbox.table,
+	), row.ID, attempts, cause.Error(), r.options.Delay.Attempt(uint(attempts)).Milliseconds())
+	return err
+}
+
+func (row outboxRow) publishing() (amqp.Publishing, error) {
+	var properties outboxProperties
+	if len(row.Properties) > 0 {
+		if err := json.Unmarshal(row.Properties, &properties); err != nil {
+			return amqp.Publishing{}, fmt.Errorf("decode properties: %w", err)
+		}
+	}
+	headers, err := decodeHeaders(row.Headers)
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("decode headers: %w", err)
+	}
+	msg := amqp.Publishing{
+		Headers:         headers,
+		ContentType:     properties.ContentType,
+		ContentEncoding: properties.ContentEncoding,
+		DeliveryMode:    properties.DeliveryMode,
+		Priority:        properties.Priority,
+		CorrelationId:   properties.CorrelationId,
+		ReplyTo:         properties.ReplyTo,
+		Expiration:      properties.Expiration,
+		MessageId:       properties.MessageId,
+		Type:            properties.Type,
+		UserId:          properties.UserId,
+		AppId:           properties.AppId,
+		Body:            row.Body,
+	}
+	if properties.Timestamp != nil {
+		msg.Timestamp = *properties.Timestamp
+	}
+	return msg, nil
+}
+
+func newOutboxProperties(msg amqp.Publishing) outboxProperties {
+	properties := outboxProperties{
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+	}
+	if !msg.Timestamp.IsZero() {
+		properties.Timestamp = &msg.Timestamp
+	}
+	return properties
+}
+
+func encodeHeaders(headers amqp.Table) ([]byte, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if err := headers.Validate(); err != nil {
+		return nil, err
+	}
+	v, err := encodeHeader(headers)
+	if err != nil {
+		return nil, err
+	}
+	return v.Value, nil
+}
+
+func decodeHeaders(data []byte) (amqp.Table, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	v, err := decodeHeader(headerValue{Type: "table", Value: data})
+	if err != nil {
+		return nil, err
+	}
+	return v.(amqp.Table), nil
+}
+
+func encodeHeader(v any) (headerValue, error) {
+	var tag string
+	switch v := v.(type) {
+	case nil:
+		return headerValue{Type: "null"}, nil
+	case bool:
+		tag = "bool"
+	case byte:
+		tag = "byte"
+	case int8:
+		tag = "int8"
+	case int:
+		tag = "int"
+	case int16:
+		tag = "int16"
+	case int32:
+		tag = "int32"
+	case int64:
+		tag = "int64"
+	case float32:
+		tag = "float32"
+	case float64:
+		tag = "float64"
+	case string:
+		tag = "string"
+	case []byte:
+		tag = "bytes"
+	case amqp.Decimal:
+		tag = "decimal"
+	case time.Time:
+		tag = "time"
+	case amqp.Table:
+		table := make(map[string]headerValue, len(v))
+		for key, field := range v {
+			encoded, err := encodeHeader(field)
+			if err != nil {
+				return headerValue{}, fmt.Errorf("%s: %w", key, err)
+			}
+			table[key] = encoded
+		}
+		return marshalHeader("table", table)
+	case []any:
+		array := make([]headerValue, len(v))
+		for i, field := range v {
+			encoded, err := encodeHeader(field)
+			if err != nil {
+				return headerValue{}, fmt.Errorf("%d: %w", i, err)
+			}
+			array[i] = encoded
+		}
+		return marshalHeader("array", array)
+	default:
+		return headerValue{}, fmt.Errorf("unsupported header type %T", v)
+	}
+	return marshalHeader(tag, v)
+}
+
+func marshalHeader(tag string, v any) (headerValue, error) {
+	data, err := json.Marshal(v)
+	return headerValue{Type: tag, Value: data}, err
+}
+
+func decodeHeader(v headerValue) (any, error) {
+	switch v.Type {
+	case "null":
+		return nil, nil
+	case "bool":
+		return unmarshalHeader[bool](v.Value)
+	case "byte":
+		return unmarshalHeader[byte](v.Value)
+	case "int8":
+		return unmarshalHeader[int8](v.Value)
+	case "int":
+		return unmarshalHeader[int](v.Value)
+	case "int16":
+		return unmarshalHeader[int16](v.Value)
+	case "int32":
+		return unmarshalHeader[int32](v.Value)
+	case "int64":
+		return unmarshalHeader[int64](v.Value)
+	case "float32":
+		return unmarshalHeader[float32](v.Value)
+	case "float64":
+		return unmarshalHeader[float64](v.Value)
+	case "string":
+		return unmarshalHeader[string](v.Value)
+	case "bytes":
+		return unmarshalHeader[[]byte](v.Value)
+	case "decimal":
+		return unmarshalHeader[amqp.Decimal](v.Value)
+	case "time":
+		return unmarshalHeader[time.Time](v.Value)
+	case "table":
+		fields, err := unmarshalHeader[map[string]headerValue](v.Value)
+		if err != nil {
+			return nil, err
+		}
+		table := make(amqp.Table, len(fields))
+		for key, field := range fields {
+			if table[key], err = decodeHeader(field); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		return table, nil
+	case "array":
+		fields, err := unmarshalHeader[[]headerValue](v.Value)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]any, len(fields))
+		for i, field := range fields {
+			if array[i], err = decodeHeader(field); err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+		}
+		return array, nil
+	default:
+		return nil, fmt.Errorf("unknown header type %q", v.Type)
+	}
+}
+
+func unmarshalHeader[T any](data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/mq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutboxHeaders(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	headers := amqp.Table{
+		"bool":    true,
+		"byte":    byte(7),
+		"int8":    int8(-8),
+		"int":     42,
+		"int16":   int16(-16),
+		"int32":   int32(32),
+		"int64":   int64(1) << 60,
+		"float32": float32(1.5),
+		"float64": 2.25,
+		"string":  "x",
+		"bytes":   []byte{0, 1, 2},
+		"decimal": amqp.Decimal{Scale: 2, Value: 1234},
+		"time":    at,
+		"null":    nil,
+		"table":   amqp.Table{"retries": int32(3), "nested": amqp.Table{"ok": false}},
+		"array":   []any{int64(1), "two", amqp.Table{"three": 3.0}},
+	}
+	data, err := encodeHeaders(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeHeaders(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, headers) {
+		t.Errorf("decoded headers differ:\ngot  %#v\nwant %#v", decoded, headers)
+	}
+
+	if data, err = encodeHeaders(nil); err != nil || data != nil {
+		t.Errorf("empty headers encoded as %q, %v", data, err)
+	}
+	if _, err = encodeHeaders(amqp.Table{"uint": uint(1)}); err == nil {
+		t.Error("unsupported header type encoded")
+	}
+	if _, err = decodeHeaders([]byte(`{"a":{"t":"uint","v":1}}`)); err == nil {
+		t.Error("unknown header type decoded")
+	}
+}
+
+func TestOutboxPublish(t *testing.T) {
+	msg := amqp.Publishing{
+		Headers:         amqp.Table{"attempt": int32(2)},
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		DeliveryMode:    amqp.Persistent,
+		Priority:        5,
+		CorrelationId:   "corr",
+		ReplyTo:         "replies",
+		Expiration:      "60000",
+		MessageId:       "msg-1",
+		Timestamp:       time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Type:            "order.created",
+		UserId:          "guest",
+		AppId:           "orders",
+		Body:            []byte(`{"id":1}`),
+	}
+	executor := &fakeExecutor{}
+	outbox := NewOutbox("app.outbox", "")
+	// The outbox is not scoped data: publishing under a scope must not fail.
+	ctx := WithScope(context.Background(), Scope{"tenant_id": 7})
+	if err := outbox.Publish(ctx, executor, "orders", "created", msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(executor.stmts) != 2 {
+		t.Fatalf("statements = %v", executor.stmts)
+	}
+	insert := executor.stmts[0]
+	if want := `INSERT INTO "app"."outbox" (exchange, routing_key, properties, headers, body) VALUES ($1, $2, $3, $4, $5)`; insert.sql != want {
+		t.Errorf("sql = %q", insert.sql)
+	}
+	if notify := executor.stmts[1]; notify.args[0] != "app.outbox" {
+		t.Errorf("notified channel %v, want the table name", notify.args[0])
+	}
+
+	var published amqp.Publishing
+	relay := NewOutboxRelay("relay", nil, outbox, map[string]mq.RawProducer{
+		"orders": func(_ context.Context, msg amqp.Publishing, routingKey string) error {
+			if routingKey != "created" {
+				t.Errorf("routing key = %q", routingKey)
+			}
+			published = msg
+			return nil
+		},
+	}, RelayOptions{})
+	row := outboxRow{
+		ID:         1,
+		Exchange:   insert.args[0].(string),
+		RoutingKey: insert.args[1].(string),
+		Properties: insert.args[2].([]byte),
+		Headers:    insert.args[3].([]byte),
+		Body:       insert.args[4].([]byte),
+	}
+	if err := relay.publish(context.Background(), row); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(published, msg) {
+		t.Errorf("published message differs:\ngot  %+v\nwant %+v", published, msg)
+	}
+
+	row.Exchange = "unknown"
+	if err := relay.publish(context.Background(), row); err == nil {
+		t.Error("published without a producer")
+	}
+	errInsert := errors.New("insert failed")
+	if err := outbox.Publish(context.Background(), &fakeExecutor{err: errInsert}, "orders", "", msg); !errors.Is(err, errInsert) {
+		t.Errorf("insert error = %v", err)
+	}
+}
+
+func TestOutboxRelayFailingBatch(t *testing.T) {
+	row := func(id int64) []any {
+		return []any{id, "unknown", "created", []byte(`{}`), []byte(`{}`), []byte(`{}`), 0}
+	}
+	tx := &fakeTx{
+		columns: []string{"id", "exchange", "routing_key", "properties", "headers", "body", "attempts"},
+		rows:    [][]any{row(1), row(2)},
+	}
+	relay := NewOutboxRelay("relay", fakeBeginner{tx: tx}, NewOutbox("outbox", ""), nil, RelayOptions{
+		BatchSize:    2,
+		PollInterval: time.Hour,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := relay.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run = %v", err)
+	}
+	if tx.queried != 1 {
+		t.Errorf("claimed %d times, want the relay to wait after a failed batch", tx.queried)
+	}
+	if len(tx.execs) != 2 || tx.execs[0][4] != time.Second.Milliseconds() {
+		t.Errorf("failed rows rescheduled with %v, want the default delay", tx.execs)
+	}
+}
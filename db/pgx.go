@@ -2,18 +2,31 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"log"
 )
 
-type PGX struct {
-	pool *pgxpool.Pool
-}
+type (
+	PGX struct {
+		pool     *pgxpool.Pool
+		tracer   TxTracer
+		replicas *replicaSet
+		tx       pgx.Tx
+	}
+
+	Beginner interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+	}
+
+	TxFunc func(tx pgx.Tx) error
+)
 
 func New(pool *pgxpool.Pool) PGX {
+	tracer, _ := pool.Config().ConnConfig.Tracer.(TxTracer)
 	return PGX{
-		pool: pool,
+		pool:   pool,
+		tracer: tracer,
 	}
 }
 
@@ -21,27 +34,136 @@ func (p PGX) DB() *pgxpool.Pool {
 	return p.pool
 }
 
+// WithTx returns a copy of p bound to tx: every statement runs in tx and
+// transactions become savepoints. Meant for tests that roll tx back at the
+// end; tx must not be used concurrently.
+func (p PGX) WithTx(tx pgx.Tx) PGX {
+	p.tx = tx
+	return p
+}
+
+// txFrom returns the transaction carried by ctx, or the one p is bound to.
+// Another kind of context executor never takes a statement out of p.tx.
+func (p PGX) txFrom(ctx context.Context) (pgx.Tx, bool) {
+	if tx, ok := ExecutorFrom(ctx, nil).(pgx.Tx); ok {
+		return tx, true
+	}
+	return p.tx, p.tx != nil
+}
+
 func (p PGX) Begin(ctx context.Context) (pgx.Tx, error) {
+	if p.tx != nil {
+		return p.tx.Begin(ctx)
+	}
 	return p.pool.Begin(ctx)
 }
 
-func (p PGX) RunInTransaction(ctx context.Context, fn func(tx pgx.Tx) error) error {
-	tx, err := p.Begin(ctx)
-	defer CommitOrRollback(ctx, tx, err)
-	err = fn(tx)
+// RunInTransaction runs fn in a transaction, or in a savepoint of the one
+// carried by ctx. Code that takes its executor from the context should run
+// under RunInContext, which hands fn the context carrying the transaction.
+func (p PGX) RunInTransaction(ctx context.Context, fn TxFunc) error {
+	return p.runInTransaction(ctx, func(_ context.Context, tx pgx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func (p PGX) runInTransaction(ctx context.Context, fn func(ctx context.Context, tx pgx.Tx) error) error {
+	var beginner Beginner = p
+	if tx, ok := ExecutorFrom(ctx, nil).(pgx.Tx); ok {
+		beginner = tx
+	}
+	err := runInTransaction(ctx, beginner, p.tracer, func(ctx context.Context, tx pgx.Tx) error {
+		return fn(WithExecutor(ctx, tx), tx)
+	})
+	if err == nil {
+		markWrite(ctx)
+	}
 	return err
 }
 
-func CommitOrRollback(ctx context.Context, tx pgx.Tx, err error) {
+// RunInTransaction runs fn in a transaction begun on beginner, traced by the
+// TxTracer configured on a PGX, pool or connection beginner.
+func RunInTransaction(ctx context.Context, beginner Beginner, fn TxFunc) error {
+	return runInTransaction(ctx, beginner, txTracer(beginner), func(_ context.Context, tx pgx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func runInTransaction(ctx context.Context, beginner Beginner, tracer TxTracer, fn func(ctx context.Context, tx pgx.Tx) error) (err error) {
+	if tracer != nil {
+		ctx = tracer.TraceTxStart(ctx)
+		defer func() { tracer.TraceTxEnd(ctx, err) }()
+	}
+	tx, err := beginner.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	settings := SettingsFrom(ctx)
+	var restore map[string]string
+	if savepoint(beginner) && len(settings) > 0 {
+		if restore, err = currentSettings(ctx, tx, settings); err != nil {
+			return CommitOrRollback(ctx, tx, fmt.Errorf("settings: %w", err))
+		}
+	}
+	if err = applySettings(ctx, tx, settings, true); err != nil {
+		return CommitOrRollback(ctx, tx, fmt.Errorf("settings: %w", err))
+	}
+	return RunInTx(ctx, tx, func(tx pgx.Tx) error {
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		if err := applySettings(ctx, tx, restore, true); err != nil {
+			return fmt.Errorf("restore settings: %w", err)
+		}
+		return nil
+	})
+}
+
+// savepoint reports whether transactions begun on beginner are savepoints.
+func savepoint(beginner Beginner) bool {
+	switch b := beginner.(type) {
+	case pgx.Tx:
+		return true
+	case PGX:
+		return b.tx != nil
+	}
+	return false
+}
+
+func txTracer(beginner Beginner) TxTracer {
+	var tracer pgx.QueryTracer
+	switch b := beginner.(type) {
+	case PGX:
+		return b.tracer
+	case *pgxpool.Pool:
+		tracer = b.Config().ConnConfig.Tracer
+	case *pgx.Conn:
+		tracer = b.Config().Tracer
+	}
+	txTracer, _ := tracer.(TxTracer)
+	return txTracer
+}
+
+func RunInTx(ctx context.Context, tx pgx.Tx, fn TxFunc) error {
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback(ctx)
+			panic(r)
+		}
+	}()
+	return CommitOrRollback(ctx, tx, fn(tx))
+}
+
+func CommitOrRollback(ctx context.Context, tx pgx.Tx, err error) error {
 	if err == nil {
-		err = tx.Commit(ctx)
-		if err != nil {
-			log.Println("commit error:", err)
+		if err = tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit: %w", err)
 		}
-		return
+		return nil
 	}
 
 	if rbErr := tx.Rollback(ctx); rbErr != nil {
-		log.Println("rollback error:", rbErr, "error:", err)
+		return fmt.Errorf("rollback: %w caused by: %w", rbErr, err)
 	}
+	return err
 }
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+type fakeTx struct {
+	pgx.Tx
+	commitErr, rollbackErr error
+	committed, rolledBack  bool
+	execs                  [][]any
+	begun                  []*fakeTx
+	copied                 [][]any
+	current                []string
+	columns                []string
+	rows                   [][]any
+	queried                int
+}
+
+func (tx *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	savepoint := &fakeTx{current: tx.current}
+	tx.begun = append(tx.begun, savepoint)
+	return savepoint, nil
+}
+
+func (tx *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, append([]any{sql}, args...))
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *fakeTx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	tx.queried++
+	return newFakeRows(tx.columns, tx.rows...), nil
+}
+
+func (tx *fakeTx) QueryRow(context.Context, string, ...any) pgx.Row {
+	return fakeQueryRow{rows: newFakeRows([]string{"values"}, []any{tx.current})}
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	tx.committed = true
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	tx.rolledBack = true
+	return tx.rollbackErr
+}
+
+type fakeBeginner struct {
+	tx  *fakeTx
+	err error
+}
+
+func (b fakeBeginner) Begin(context.Context) (pgx.Tx, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.tx, nil
+}
+
+func TestRunInTransaction(t *testing.T) {
+	var (
+		errFn       = errors.New("fn error")
+		errBegin    = errors.New("begin error")
+		errCommit   = errors.New("commit error")
+		errRollback = errors.New("rollback error")
+	)
+
+	type testCase struct {
+		name                  string
+		tx                    *fakeTx
+		beginErr, fnErr       error
+		want                  []error
+		committed, rolledBack bool
+	}
+	for _, tc := range []testCase{
+		{name: "commit", tx: &fakeTx{}, committed: true},
+		{name: "commit error", tx: &fakeTx{commitErr: errCommit}, want: []error{errCommit}, committed: true},
+		{name: "rollback", tx: &fakeTx{}, fnErr: errFn, want: []error{errFn}, rolledBack: true},
+		{name: "rollback error", tx: &fakeTx{rollbackErr: errRollback}, fnErr: errFn, want: []error{errFn, errRollback}, rolledBack: true},
+		{name: "begin error", tx: &fakeTx{}, beginErr: errBegin, want: []error{errBegin}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := RunInTransaction(context.Background(), fakeBeginner{tx: tc.tx, err: tc.beginErr}, func(tx pgx.Tx) error {
+				return tc.fnErr
+			})
+			if len(tc.want) == 0 && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, want := range tc.want {
+				if !errors.Is(err, want) {
+					t.Errorf("error %v is not %v", err, want)
+				}
+			}
+			if tc.tx.committed != tc.committed {
+				t.Errorf("committed = %t, want %t", tc.tx.committed, tc.committed)
+			}
+			if tc.tx.rolledBack != tc.rolledBack {
+				t.Errorf("rolled back = %t, want %t", tc.tx.rolledBack, tc.rolledBack)
+			}
+		})
+	}
+}
+
+func TestRunInTransactionPanic(t *testing.T) {
+	tx := &fakeTx{}
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want boom", r)
+		}
+		if !tx.rolledBack || tx.committed {
+			t.Errorf("committed = %t, rolled back = %t", tx.committed, tx.rolledBack)
+		}
+	}()
+	_ = RunInTransaction(context.Background(), fakeBeginner{tx: tx}, func(tx pgx.Tx) error {
+		panic("boom")
+	})
+}
+
+func TestPGXWithTx(t *testing.T) {
+	root := &fakeTx{}
+	p := PGX{}.WithTx(root)
+	ctx := WithExecutor(context.Background(), &fakeExecutor{})
+	if _, err := p.Exec(ctx, "DELETE FROM items"); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.execs) != 1 {
+		t.Error("statement escaped the bound transaction through a context executor")
+	}
+
+	carried := &fakeTx{}
+	if tx, ok := p.txFrom(WithExecutor(ctx, carried)); !ok || tx != carried {
+		t.Error("transaction carried by ctx not preferred")
+	}
+	if _, ok := (PGX{}).txFrom(ctx); ok {
+		t.Error("transaction found without one")
+	}
+}
@@ -4,40 +4,61 @@ import (
 	"context"
 	"github.com/bomjdev/yetanother/query"
 	"github.com/jackc/pgx/v5"
+	"iter"
 )
 
 type QueryFunc[T any] func(ctx context.Context, executor Executor, query query.Query) (T, error)
 
+// QueryScanner reads may go to a replica, see WithReplica.
 type QueryScanner[T any] struct {
 	factory func(query query.Query) (ExecFunc[pgx.Rows], error)
+	mapper  RowMapper[T]
 }
 
 func NewQueryScanner[T any](factory func(query query.Query) (ExecFunc[pgx.Rows], error)) QueryScanner[T] {
-	return QueryScanner[T]{factory: factory}
+	return NewQueryScannerWith(factory, MapByName[T])
+}
+
+func NewQueryScannerWith[T any](factory func(query query.Query) (ExecFunc[pgx.Rows], error), mapper RowMapper[T]) QueryScanner[T] {
+	return QueryScanner[T]{factory: factory, mapper: mapper}
 }
 
 func (s QueryScanner[T]) Scan(ctx context.Context, executor Executor, query query.Query) ([]T, error) {
+	ctx = WithReplica(ctx)
 	fn, err := s.factory(query)
 	if err != nil {
 		return nil, err
 	}
-	return ExecWithScanner(fn, Scan[T])(ctx, executor)
+	return ExecWithScanner(fn, ScanWith(s.mapper))(ctx, executor)
 }
 
 func (s QueryScanner[T]) ScanOne(ctx context.Context, executor Executor, query query.Query) (T, error) {
+	ctx = WithReplica(ctx)
 	var zero T
 	fn, err := s.factory(query)
 	if err != nil {
 		return zero, err
 	}
-	return ExecWithScanner(fn, ScanOne[T])(ctx, executor)
+	return ExecWithScanner(fn, ScanOneWith(s.mapper))(ctx, executor)
 }
 
 func (s QueryScanner[T]) ScanExactlyOne(ctx context.Context, executor Executor, query query.Query) (T, error) {
+	ctx = WithReplica(ctx)
 	var zero T
 	fn, err := s.factory(query)
 	if err != nil {
 		return zero, err
 	}
-	return ExecWithScanner(fn, ScanExactlyOne[T])(ctx, executor)
+	return ExecWithScanner(fn, ScanExactlyOneWith(s.mapper))(ctx, executor)
+}
+
+func (s QueryScanner[T]) Iter(ctx context.Context, executor Executor, query query.Query) iter.Seq2[T, error] {
+	ctx = WithReplica(ctx)
+	return lazyIter(func() (iter.Seq2[T, error], error) {
+		fn, err := s.factory(query)
+		if err != nil {
+			return nil, err
+		}
+		return ExecWithScanner(fn, ScanIterWith(s.mapper))(ctx, executor)
+	})
 }
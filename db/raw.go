@@ -15,24 +15,42 @@ func (f RawExecFunc[T]) WithStatement(stmt string) StmtExecFunc[T] {
 	}
 }
 
+// WithBuilder runs builder restricted to the ctx scope, see Scope.Apply.
 func (f RawExecFunc[T]) WithBuilder(builder squirrel.Sqlizer) ExecFunc[T] {
 	return func(ctx context.Context, executor Executor) (T, error) {
 		var zero T
-		stmt, args, err := builder.ToSql()
+		scoped, err := ScopeFrom(ctx).Apply(builder)
 		if err != nil {
 			return zero, err
 		}
-		return f(ctx, executor, stmt, args...)
+		stmt, args, err := scoped.ToSql()
+		if err != nil {
+			return zero, err
+		}
+		return f(Unscoped(ctx), executor, stmt, args...)
 	}
 }
 
 func (f RawExecFunc[T]) SelectFactory(builder squirrel.SelectBuilder) func(query query.Query) (ExecFunc[T], error) {
+	return f.SelectFactoryFor("", builder)
+}
+
+// SelectFactoryFor is SelectFactory with the scope columns qualified by
+// table, for builders that join other tables.
+func (f RawExecFunc[T]) SelectFactoryFor(table string, builder squirrel.SelectBuilder) func(query query.Query) (ExecFunc[T], error) {
 	return func(query query.Query) (ExecFunc[T], error) {
-		b, err := buildQuery(query, builder)
-		if err != nil {
+		if _, err := buildQuery(query, builder); err != nil {
 			return nil, err
 		}
-		return f.WithBuilder(b), nil
+		return func(ctx context.Context, executor Executor) (T, error) {
+			scope := ScopeFrom(ctx)
+			b, err := buildQuery(scope.Query(query), builder)
+			if err != nil {
+				var zero T
+				return zero, err
+			}
+			return f.WithBuilder(scoped(scope.selectWhere(b, table)))(ctx, executor)
+		}, nil
 	}
 }
 
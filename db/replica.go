@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	Balance int
+
+	ReplicaOptions struct {
+		Balance        Balance
+		ReadYourWrites time.Duration
+		Cooldown       time.Duration
+	}
+
+	replicaSet struct {
+		pools   []*pgxpool.Pool
+		down    []atomic.Int64
+		next    atomic.Uint64
+		options ReplicaOptions
+	}
+
+	writeMark struct {
+		at atomic.Int64
+	}
+
+	// rowsRow reads the first row of rows as pgx.Row does.
+	rowsRow struct {
+		rows pgx.Rows
+		err  error
+	}
+
+	writeMarkKey struct{}
+	primaryKey   struct{}
+	replicaKey   struct{}
+)
+
+const (
+	RoundRobin Balance = iota
+	LeastBusy
+)
+
+const defaultCooldown = 10 * time.Second
+
+func NewWithReplicas(primary *pgxpool.Pool, replicas []*pgxpool.Pool, options ReplicaOptions) PGX {
+	p := New(primary)
+	if len(replicas) == 0 {
+		return p
+	}
+	if options.Cooldown == 0 {
+		options.Cooldown = defaultCooldown
+	}
+	p.replicas = &replicaSet{
+		pools:   replicas,
+		down:    make([]atomic.Int64, len(replicas)),
+		options: options,
+	}
+	return p
+}
+
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(writeMarkKey{}).(*writeMark); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, writeMarkKey{}, new(writeMark))
+}
+
+// WithReplica lets queries run with ctx outside a transaction go to a
+// replica. QueryScanner and StmtScanner mark their reads with it; use
+// WithPrimary for those that write or must not lag, statements are not
+// inspected.
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+// WithPrimary sends queries to the primary even under WithReplica.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func markWrite(ctx context.Context) {
+	if mark, ok := ctx.Value(writeMarkKey{}).(*writeMark); ok {
+		mark.at.Store(time.Now().UnixNano())
+	}
+}
+
+func (p PGX) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if tx, ok := p.txFrom(ctx); ok {
+		return execTx(ctx, tx, sql, args...)
+	}
+	markWrite(ctx)
+	settings := SettingsFrom(ctx)
+	if len(settings) == 0 {
+		return p.pool.Exec(ctx, sql, args...)
+	}
+	conn, err := acquireWithSettings(ctx, p.pool, settings)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer releaseSettings(conn, settings)
+	return conn.Exec(ctx, sql, args...)
+}
+
+func (p PGX) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if tx, ok := p.txFrom(ctx); ok {
+		return queryTx(ctx, tx, sql, args...)
+	}
+	i, replica := p.reader(ctx)
+	if replica == nil {
+		if !replicaEligible(ctx) {
+			markWrite(ctx)
+		}
+		return queryPool(ctx, p.pool, sql, args...)
+	}
+	rows, err := queryPool(ctx, replica, sql, args...)
+	var pgErr *pgconn.PgError
+	if err != nil && !errors.As(err, &pgErr) && ctx.Err() == nil {
+		p.replicas.markDown(i)
+		return queryPool(ctx, p.pool, sql, args...)
+	}
+	return rows, err
+}
+
+func (p PGX) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if tx, ok := p.txFrom(ctx); ok {
+		if len(SettingsFrom(ctx)) > 0 {
+			rows, err := queryTx(ctx, tx, sql, args...)
+			return rowsRow{rows: rows, err: err}
+		}
+		return tx.QueryRow(ctx, sql, args...)
+	}
+	if p.replicaRead(ctx) {
+		rows, err := p.Query(ctx, sql, args...)
+		return rowsRow{rows: rows, err: err}
+	}
+	if !replicaEligible(ctx) {
+		markWrite(ctx)
+	}
+	if len(SettingsFrom(ctx)) > 0 {
+		rows, err := queryPool(ctx, p.pool, sql, args...)
+		return rowsRow{rows: rows, err: err}
+	}
+	return p.pool.QueryRow(ctx, sql, args...)
+}
+
+func (r rowsRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
+
+func (p PGX) reader(ctx context.Context) (int, *pgxpool.Pool) {
+	if !p.replicaRead(ctx) {
+		return -1, nil
+	}
+	return p.replicas.pick()
+}
+
+func (p PGX) replicaRead(ctx context.Context) bool {
+	if p.replicas == nil {
+		return false
+	}
+	if !replicaEligible(ctx) {
+		return false
+	}
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return false
+	}
+	if mark, ok := ctx.Value(writeMarkKey{}).(*writeMark); ok {
+		if at := mark.at.Load(); at != 0 && time.Since(time.Unix(0, at)) < p.replicas.options.ReadYourWrites {
+			return false
+		}
+	}
+	return true
+}
+
+// replicaEligible reports whether ctx marks a read, which leaves the
+// read-your-writes mark alone even when it runs on the primary.
+func replicaEligible(ctx context.Context) bool {
+	replica, _ := ctx.Value(replicaKey{}).(bool)
+	return replica
+}
+
+func (s *replicaSet) pick() (int, *pgxpool.Pool) {
+	now := time.Now().UnixNano()
+	best := -1
+	switch s.options.Balance {
+	case LeastBusy:
+		for i, pool := range s.pools {
+			if s.down[i].Load() > now {
+				continue
+			}
+			if best == -1 || pool.Stat().AcquiredConns() < s.pools[best].Stat().AcquiredConns() {
+				best = i
+			}
+		}
+	default:
+		start := s.next.Add(1)
+		for n := range s.pools {
+			i := int((start + uint64(n)) % uint64(len(s.pools)))
+			if s.down[i].Load() <= now {
+				best = i
+				break
+			}
+		}
+	}
+	if best == -1 {
+		return -1, nil
+	}
+	return best, s.pools[best]
+}
+
+func (s *replicaSet) markDown(i int) {
+	s.down[i].Store(time.Now().Add(s.options.Cooldown).UnixNano())
+}
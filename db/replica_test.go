@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/query"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, host string) *pgxpool.Pool {
+	return newTestPoolPort(t, host, 0)
+}
+
+func newTestPoolPort(t *testing.T, host string, port int) *pgxpool.Pool {
+	cfg, err := Config{Credentials: Credentials{Host: host, Port: port, SSLMode: "disable"}}.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestReplicaRouting(t *testing.T) {
+	primary := newTestPool(t, "primary")
+	replicas := []*pgxpool.Pool{newTestPool(t, "replica1"), newTestPool(t, "replica2")}
+	p := NewWithReplicas(primary, replicas, ReplicaOptions{ReadYourWrites: time.Minute})
+
+	if _, pool := p.reader(context.Background()); pool != nil {
+		t.Error("read routed to replica without WithReplica")
+	}
+
+	ctx := WithReplica(WithReadYourWrites(context.Background()))
+	seen := make(map[*pgxpool.Pool]bool)
+	for range 4 {
+		_, pool := p.reader(ctx)
+		if pool == nil {
+			t.Fatal("read not routed to replica")
+		}
+		seen[pool] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("round robin used %d replicas, want 2", len(seen))
+	}
+
+	if _, pool := p.reader(WithPrimary(ctx)); pool != nil {
+		t.Error("WithPrimary routed to replica")
+	}
+
+	markWrite(ctx)
+	if _, pool := p.reader(ctx); pool != nil {
+		t.Error("read after write routed to replica")
+	}
+
+	p.replicas.markDown(0)
+	p.replicas.markDown(1)
+	if _, pool := p.reader(WithReplica(context.Background())); pool != nil {
+		t.Error("read routed to unhealthy replica")
+	}
+}
+
+func TestReplicaFailover(t *testing.T) {
+	primary := newTestPoolPort(t, "127.0.0.1", 1)
+	replica := newTestPoolPort(t, "127.0.0.1", 1)
+	p := NewWithReplicas(primary, []*pgxpool.Pool{replica}, ReplicaOptions{})
+	ctx := WithReplica(context.Background())
+
+	var n int
+	if err := p.QueryRow(ctx, "SELECT 1").Scan(&n); err == nil {
+		t.Fatal("query on unreachable servers succeeded")
+	}
+	if p.replicas.down[0].Load() <= time.Now().UnixNano() {
+		t.Error("QueryRow did not mark the unreachable replica down")
+	}
+	if _, pool := p.reader(ctx); pool != nil {
+		t.Error("read routed to the replica during its cooldown")
+	}
+}
+
+func TestRowsRow(t *testing.T) {
+	var name string
+	if err := (rowsRow{rows: newFakeRows([]string{"name"}, []any{"a"}, []any{"b"})}).Scan(&name); err != nil || name != "a" {
+		t.Errorf("scan = %q, %v", name, err)
+	}
+	if err := (rowsRow{rows: newFakeRows([]string{"name"})}).Scan(&name); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("empty rows: %v", err)
+	}
+	errQuery := errors.New("query failed")
+	if err := (rowsRow{err: errQuery}).Scan(&name); !errors.Is(err, errQuery) {
+		t.Errorf("query error: %v", err)
+	}
+	failed := newFakeRows([]string{"name"})
+	failed.err = errQuery
+	if err := (rowsRow{rows: failed}).Scan(&name); !errors.Is(err, errQuery) {
+		t.Errorf("rows error: %v", err)
+	}
+}
+
+// replicaProbe records whether each query may go to a replica.
+type replicaProbe struct {
+	fakeExecutor
+	eligible []bool
+}
+
+func (e *replicaProbe) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	e.eligible = append(e.eligible, replicaEligible(ctx))
+	return e.fakeExecutor.Query(ctx, sql, args...)
+}
+
+func TestScannersReadFromReplicas(t *testing.T) {
+	ctx := context.Background()
+	probe := &replicaProbe{}
+	if _, err := NewStmtFactoryWith("SELECT 1", MapScalar[int]).Scan(ctx, probe); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewQueryScanner[scopeTestAccount](GetRows.SelectFactory(Postgres.Select("*").From("accounts"))).Scan(ctx, probe, query.Query{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetRows(ctx, probe, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(probe.eligible, []bool{true, true, false}) {
+		t.Errorf("replica eligible = %v, want scanner reads only", probe.eligible)
+	}
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/bomjdev/yetanother/query"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+type (
+	RepositoryOptions struct {
+		CreatedAt string
+		UpdatedAt string
+		DeletedAt string
+		Version   string
+	}
+
+	Repository[T any, ID any] struct {
+		table     string
+		fields    fields
+		pk        field
+		version   field
+		versioned bool
+		options   RepositoryOptions
+		list      QueryScanner[T]
+	}
+)
+
+func NewRepository[T any, ID any](table string, options RepositoryOptions) (Repository[T, ID], error) {
+	fs, err := structFields[T]()
+	if err != nil {
+		return Repository[T, ID]{}, err
+	}
+	pk, ok := fs.pk()
+	if !ok {
+		return Repository[T, ID]{}, fmt.Errorf("%s: no primary key field", table)
+	}
+	r := Repository[T, ID]{
+		table:   table,
+		fields:  fs,
+		pk:      pk,
+		options: options,
+	}
+	if options.Version != "" {
+		r.version, r.versioned = fs.byName(options.Version)
+		if !r.versioned {
+			return Repository[T, ID]{}, fmt.Errorf("%s: no version field %q", table, options.Version)
+		}
+	} else {
+		r.version, r.versioned = fs.version()
+	}
+	r.list = NewQueryScanner[T](GetRows.SelectFactoryFor(table, r.selectBuilder()))
+	return r, nil
+}
+
+func (r Repository[T, ID]) Table() string {
+	return r.table
+}
+
+func (r Repository[T, ID]) Columns() []string {
+	return r.fields.names()
+}
+
+func (r Repository[T, ID]) selectBuilder() squirrel.SelectBuilder {
+	builder := Postgres.Select(r.fields.names()...).From(r.table)
+	if r.options.DeletedAt != "" {
+		builder = builder.Where(squirrel.Eq{r.options.DeletedAt: nil})
+	}
+	return builder
+}
+
+// where returns the ctx scope predicate on the table, nil without a scope.
+func (r Repository[T, ID]) where(ctx context.Context) any {
+	scope := ScopeFrom(ctx)
+	if len(scope) == 0 {
+		return nil
+	}
+	return scope.Where(r.table)
+}
+
+func (r Repository[T, ID]) returning() string {
+	return "RETURNING " + strings.Join(r.fields.names(), ", ")
+}
+
+// scanOne runs a builder the scope was applied to.
+func (r Repository[T, ID]) scanOne(ctx context.Context, executor Executor, builder squirrel.Sqlizer) (T, error) {
+	return ExecWithScanner(GetRows.WithBuilder(scoped(builder)), ScanExactlyOne[T])(ctx, executor)
+}
+
+func (r Repository[T, ID]) Get(ctx context.Context, executor Executor, id ID) (T, error) {
+	return r.scanOne(ctx, executor, r.selectBuilder().Where(squirrel.Eq{r.pk.name: id}).Where(r.where(ctx)))
+}
+
+func (r Repository[T, ID]) List(ctx context.Context, executor Executor, query query.Query) ([]T, error) {
+	return r.list.Scan(ctx, executor, query)
+}
+
+func (r Repository[T, ID]) Insert(ctx context.Context, executor Executor, v T) (T, error) {
+	columns, values := r.insertValues(ScopeFrom(ctx), v)
+	return r.scanOne(ctx, executor, Postgres.
+		Insert(r.table).
+		Columns(columns...).
+		Values(values...).
+		Suffix(r.returning()))
+}
+
+// Upsert inserts v or updates the row with its key, reviving it when it was
+// soft-deleted.
+func (r Repository[T, ID]) Upsert(ctx context.Context, executor Executor, v T) (T, error) {
+	columns, values := r.insertValues(ScopeFrom(ctx), v)
+	conflict := []string{r.pk.name}
+	set := excluded(conflict, slices.DeleteFunc(slices.Clone(columns), func(column string) bool {
+		return column == r.options.CreatedAt || r.versioned && column == r.version.name
+	}))
+	if r.versioned {
+		set = append(set, bumpVersion(r.table, r.version.name))
+	}
+	if r.options.DeletedAt != "" {
+		set = append(set, r.options.DeletedAt+" = NULL")
+	}
+	if len(set) == 0 {
+		// DO NOTHING returns no row on conflict; a no-op update returns it.
+		set = excluded(nil, conflict)
+	}
+	builder := Postgres.
+		Insert(r.table).
+		Columns(columns...).
+		Values(values...).
+		Suffix(onConflictUpdate(conflict, set))
+	return r.scanOne(ctx, executor, ScopeFrom(ctx).conflictWhere(builder, r.table).Suffix(r.returning()))
+}
+
+func (r Repository[T, ID]) Update(ctx context.Context, executor Executor, prev, next T) (T, error) {
+	prevValue, nextValue := reflect.ValueOf(prev), reflect.ValueOf(next)
+	scope := ScopeFrom(ctx)
+	set := make(map[string]any)
+	for _, f := range r.fields {
+		if f.pk || f.readonly || r.isTimestamp(f.name) || r.versioned && f.name == r.version.name || scope.scoped(f.name) {
+			continue
+		}
+		if value := f.value(nextValue).Interface(); !reflect.DeepEqual(f.value(prevValue).Interface(), value) {
+			set[f.name] = value
+		}
+	}
+	if len(set) == 0 {
+		return next, nil
+	}
+	if r.options.UpdatedAt != "" {
+		set[r.options.UpdatedAt] = squirrel.Expr("now()")
+	}
+	builder := Postgres.
+		Update(r.table).
+		SetMap(set).
+		Where(squirrel.Eq{r.pk.name: r.pk.value(prevValue).Interface()}).
+		Where(r.where(ctx)).
+		Suffix(r.returning())
+	if r.options.DeletedAt != "" {
+		builder = builder.Where(squirrel.Eq{r.options.DeletedAt: nil})
+	}
+	if !r.versioned {
+		return r.scanOne(ctx, executor, builder)
+	}
+	version := r.version.value(prevValue).Interface()
+	updated, err := r.scanOne(ctx, executor, withVersion(builder, r.version.name, version))
+	if errors.Is(err, ErrNotFound) {
+		return updated, &Error{Kind: ErrStaleVersion, Table: r.table, Err: fmt.Errorf("version %v", version)}
+	}
+	return updated, err
+}
+
+func (r Repository[T, ID]) Delete(ctx context.Context, executor Executor, id ID) error {
+	var builder squirrel.Sqlizer = Postgres.
+		Delete(r.table).
+		Where(squirrel.Eq{r.pk.name: id}).
+		Where(r.where(ctx))
+	if r.options.DeletedAt != "" {
+		builder = Postgres.
+			Update(r.table).
+			Set(r.options.DeletedAt, squirrel.Expr("now()")).
+			Where(squirrel.Eq{r.pk.name: id, r.options.DeletedAt: nil}).
+			Where(r.where(ctx))
+	}
+	tag, err := Exec.WithBuilder(scoped(builder))(ctx, executor)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return &Error{Kind: ErrNotFound, Table: r.table, Err: fmt.Errorf("delete %v", id)}
+	}
+	return nil
+}
+
+// insertValues returns the columns and values inserting v, with the scope
+// columns set from scope.
+func (r Repository[T, ID]) insertValues(scope Scope, v T) ([]string, []any) {
+	fs := make(fields, 0, len(r.fields))
+	for _, f := range r.fields {
+		if !r.isTimestamp(f.name) {
+			fs = append(fs, f)
+		}
+	}
+	columns, rows := scope.values(insertRows(fs, []reflect.Value{reflect.ValueOf(v)}))
+	values := rows[0]
+	for _, column := range []string{r.options.CreatedAt, r.options.UpdatedAt} {
+		if column != "" {
+			columns = append(columns, column)
+			values = append(values, squirrel.Expr("now()"))
+		}
+	}
+	return columns, values
+}
+
+func (r Repository[T, ID]) isTimestamp(column string) bool {
+	return column != "" && (column == r.options.CreatedAt || column == r.options.UpdatedAt || column == r.options.DeletedAt)
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/bomjdev/yetanother/query"
+	"github.com/jackc/pgx/v5/pgconn"
+	"slices"
+	"testing"
+	"time"
+)
+
+type repoAccount struct {
+	ID        int64      `db:"id,pk"`
+	Name      string     `db:"name"`
+	Email     string     `db:"email"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+var repoAccountColumns = []string{"id", "name", "email", "created_at", "updated_at", "deleted_at"}
+
+func repoAccountRow(a repoAccount) []any {
+	return []any{a.ID, a.Name, a.Email, a.CreatedAt, a.UpdatedAt, a.DeletedAt}
+}
+
+func newAccountRepository(t *testing.T) Repository[repoAccount, int64] {
+	t.Helper()
+	repo, err := NewRepository[repoAccount, int64]("accounts", RepositoryOptions{
+		CreatedAt: "created_at",
+		UpdatedAt: "updated_at",
+		DeletedAt: "deleted_at",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func assertStmt(t *testing.T, got fakeStmt, sql string, args ...any) {
+	t.Helper()
+	if got.sql != sql || !slices.Equal(got.args, args) {
+		t.Errorf("got %q %v\nwant %q %v", got.sql, got.args, sql, args)
+	}
+}
+
+func TestRepositoryRead(t *testing.T) {
+	repo := newAccountRepository(t)
+	want := repoAccount{ID: 1, Name: "a", Email: "a@b.c"}
+	executor := &fakeExecutor{results: []*fakeRows{
+		newFakeRows(repoAccountColumns, repoAccountRow(want)),
+		newFakeRows(repoAccountColumns, repoAccountRow(want)),
+	}}
+	ctx := context.Background()
+
+	got, err := repo.Get(ctx, executor, 1)
+	if err != nil || got != want {
+		t.Errorf("Get = %+v, %v", got, err)
+	}
+	assertStmt(t, executor.stmts[0],
+		"SELECT id, name, email, created_at, updated_at, deleted_at FROM accounts WHERE deleted_at IS NULL AND id = $1", int64(1))
+
+	list, err := repo.List(ctx, executor, query.Query{
+		Filters: map[string][]query.Filter{"name": {{Value: "a"}}},
+		Limit:   10,
+	})
+	if err != nil || len(list) != 1 || list[0] != want {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+	assertStmt(t, executor.stmts[1],
+		"SELECT id, name, email, created_at, updated_at, deleted_at FROM accounts WHERE deleted_at IS NULL AND (name = $1) LIMIT 10", "a")
+
+	if _, err = repo.Get(ctx, executor, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing row: %v", err)
+	}
+}
+
+func TestRepositoryWrite(t *testing.T) {
+	repo := newAccountRepository(t)
+	ctx := context.Background()
+	stored := repoAccount{ID: 1, Name: "a", Email: "a@b.c"}
+	executor := &fakeExecutor{results: []*fakeRows{
+		newFakeRows(repoAccountColumns, repoAccountRow(stored)),
+		newFakeRows(repoAccountColumns, repoAccountRow(stored)),
+		newFakeRows(repoAccountColumns, repoAccountRow(stored)),
+	}}
+
+	inserted, err := repo.Insert(ctx, executor, repoAccount{Name: "a", Email: "a@b.c", CreatedAt: time.Now()})
+	if err != nil || inserted != stored {
+		t.Errorf("Insert = %+v, %v", inserted, err)
+	}
+	assertStmt(t, executor.stmts[0],
+		"INSERT INTO accounts (name,email,created_at,updated_at) VALUES ($1,$2,now(),now()) "+
+			"RETURNING id, name, email, created_at, updated_at, deleted_at", "a", "a@b.c")
+
+	if _, err = repo.Update(ctx, executor, stored, repoAccount{ID: 1, Name: "b", Email: "a@b.c", UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	assertStmt(t, executor.stmts[1],
+		"UPDATE accounts SET name = $1, updated_at = now() WHERE id = $2 AND deleted_at IS NULL "+
+			"RETURNING id, name, email, created_at, updated_at, deleted_at", "b", int64(1))
+
+	if updated, err := repo.Update(ctx, executor, stored, stored); err != nil || updated != stored || len(executor.stmts) != 2 {
+		t.Errorf("unchanged Update = %+v, %v, statements %d", updated, err, len(executor.stmts))
+	}
+
+	if _, err = repo.Upsert(ctx, executor, stored); err != nil {
+		t.Fatal(err)
+	}
+	assertStmt(t, executor.stmts[2],
+		"INSERT INTO accounts (id,name,email,created_at,updated_at) VALUES ($1,$2,$3,now(),now()) "+
+			"ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, email = EXCLUDED.email, updated_at = EXCLUDED.updated_at, deleted_at = NULL "+
+			"RETURNING id, name, email, created_at, updated_at, deleted_at", int64(1), "a", "a@b.c")
+}
+
+func TestRepositoryUpsertConflictOnly(t *testing.T) {
+	type tag struct {
+		ID int64 `db:"id,pk"`
+	}
+	repo, err := NewRepository[tag, int64]("tags", RepositoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := &fakeExecutor{results: []*fakeRows{newFakeRows([]string{"id"}, []any{int64(1)})}}
+	if v, err := repo.Upsert(context.Background(), executor, tag{ID: 1}); err != nil || v.ID != 1 {
+		t.Errorf("Upsert = %+v, %v", v, err)
+	}
+	assertStmt(t, executor.stmts[0], "INSERT INTO tags (id) VALUES ($1) ON CONFLICT (id) DO UPDATE SET id = EXCLUDED.id RETURNING id", int64(1))
+}
+
+func TestRepositoryDelete(t *testing.T) {
+	ctx := context.Background()
+	executor := &fakeExecutor{tag: pgconn.NewCommandTag("UPDATE 1")}
+	if err := newAccountRepository(t).Delete(ctx, executor, 1); err != nil {
+		t.Fatal(err)
+	}
+	assertStmt(t, executor.stmts[0], "UPDATE accounts SET deleted_at = now() WHERE deleted_at IS NULL AND id = $1", int64(1))
+
+	hard, err := NewRepository[repoAccount, int64]("accounts", RepositoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor = &fakeExecutor{tag: pgconn.NewCommandTag("DELETE 0")}
+	if err = hard.Delete(ctx, executor, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete missing row: %v", err)
+	}
+	assertStmt(t, executor.stmts[0], "DELETE FROM accounts WHERE id = $1", int64(1))
+}
+
+func TestRepositoryVersion(t *testing.T) {
+	type document struct {
+		ID      int64  `db:"id,pk"`
+		Title   string `db:"title"`
+		Version int64  `db:"version,version"`
+	}
+	repo, err := NewRepository[document, int64]("documents", RepositoryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := &fakeExecutor{}
+	prev := document{ID: 1, Title: "draft", Version: 3}
+	_, err = repo.Update(context.Background(), executor, prev, document{ID: 1, Title: "final", Version: 3})
+	if !errors.Is(err, ErrStaleVersion) {
+		t.Errorf("Update without matching row: %v", err)
+	}
+	assertStmt(t, executor.stmts[0],
+		"UPDATE documents SET title = $1, version = version + 1 WHERE id = $2 AND version = $3 RETURNING id, title, version",
+		"final", int64(1), int64(3))
+
+	executor = &fakeExecutor{results: []*fakeRows{newFakeRows([]string{"id", "title", "version"}, []any{int64(1), "final", int64(4)})}}
+	upserted, err := repo.Upsert(context.Background(), executor, document{ID: 1, Title: "final", Version: 3})
+	if err != nil || upserted.Version != 4 {
+		t.Errorf("Upsert = %+v, %v", upserted, err)
+	}
+	assertStmt(t, executor.stmts[0],
+		"INSERT INTO documents (id,title,version) VALUES ($1,$2,$3) ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title, version = documents.version + 1 RETURNING id, title, version",
+		int64(1), "final", int64(3))
+
+	if _, err = NewRepository[struct{ Name string }, int64]("names", RepositoryOptions{}); err == nil {
+		t.Error("repository without primary key accepted")
+	}
+}
@@ -9,11 +9,19 @@ import (
 var GetRows RawExecFunc[pgx.Rows] = getRows
 
 func getRows(ctx context.Context, executor Executor, stmt string, args ...any) (pgx.Rows, error) {
-	return executor.Query(ctx, stmt, args...)
+	if err := checkScope(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := executor.Query(ctx, stmt, args...)
+	return rows, ClassifyError(err)
 }
 
 var Exec RawExecFunc[pgconn.CommandTag] = execNoRows
 
 func execNoRows(ctx context.Context, executor Executor, stmt string, args ...any) (pgconn.CommandTag, error) {
-	return executor.Exec(ctx, stmt, args...)
+	if err := checkScope(ctx); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := executor.Exec(ctx, stmt, args...)
+	return tag, ClassifyError(err)
 }
@@ -3,30 +3,87 @@ package db
 import (
 	"fmt"
 	"github.com/jackc/pgx/v5"
+	"iter"
 )
 
 type ScanFunc[T any] func(rows pgx.Rows) (T, error)
 
 func Scan[T any](rows pgx.Rows) ([]T, error) {
-	v, err := pgx.CollectRows(rows, pgx.RowToStructByName[T])
-	if err != nil {
-		return nil, fmt.Errorf("collect rows: %w", err)
-	}
-	return v, nil
+	return ScanWith(MapByName[T])(rows)
 }
 
 func ScanOne[T any](rows pgx.Rows) (T, error) {
-	v, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[T])
-	if err != nil {
-		return v, fmt.Errorf("collect one row: %w", err)
-	}
-	return v, nil
+	return ScanOneWith(MapByName[T])(rows)
 }
 
 func ScanExactlyOne[T any](rows pgx.Rows) (T, error) {
-	v, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[T])
-	if err != nil {
-		return v, fmt.Errorf("collect one row: %w", err)
+	return ScanExactlyOneWith(MapByName[T])(rows)
+}
+
+func ScanIter[T any](rows pgx.Rows) (iter.Seq2[T, error], error) {
+	return ScanIterWith(MapByName[T])(rows)
+}
+
+func ScanWith[T any](mapper RowMapper[T]) ScanFunc[[]T] {
+	return func(rows pgx.Rows) ([]T, error) {
+		v, err := pgx.CollectRows(rows, pgx.RowToFunc[T](mapper))
+		if err != nil {
+			return nil, ClassifyError(fmt.Errorf("collect rows: %w", err))
+		}
+		return v, nil
+	}
+}
+
+func ScanOneWith[T any](mapper RowMapper[T]) ScanFunc[T] {
+	return func(rows pgx.Rows) (T, error) {
+		v, err := pgx.CollectOneRow(rows, pgx.RowToFunc[T](mapper))
+		if err != nil {
+			return v, ClassifyError(fmt.Errorf("collect one row: %w", err))
+		}
+		return v, nil
+	}
+}
+
+func ScanExactlyOneWith[T any](mapper RowMapper[T]) ScanFunc[T] {
+	return func(rows pgx.Rows) (T, error) {
+		v, err := pgx.CollectExactlyOneRow(rows, pgx.RowToFunc[T](mapper))
+		if err != nil {
+			return v, ClassifyError(fmt.Errorf("collect one row: %w", err))
+		}
+		return v, nil
+	}
+}
+
+func ScanIterWith[T any](mapper RowMapper[T]) ScanFunc[iter.Seq2[T, error]] {
+	return func(rows pgx.Rows) (iter.Seq2[T, error], error) {
+		return func(yield func(T, error) bool) {
+			defer rows.Close()
+			for rows.Next() {
+				v, err := mapper(rows)
+				if err != nil {
+					yield(v, ClassifyError(fmt.Errorf("scan row: %w", err)))
+					return
+				}
+				if !yield(v, nil) {
+					return
+				}
+			}
+			if err := rows.Err(); err != nil {
+				var zero T
+				yield(zero, ClassifyError(fmt.Errorf("iterate rows: %w", err)))
+			}
+		}, nil
+	}
+}
+
+func lazyIter[T any](exec func() (iter.Seq2[T, error], error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		seq, err := exec()
+		if err != nil {
+			var zero T
+			yield(zero, err)
+			return
+		}
+		seq(yield)
 	}
-	return v, nil
 }
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"iter"
+	"slices"
+	"testing"
+)
+
+func TestScanIter(t *testing.T) {
+	type item struct {
+		ID int `db:"id"`
+	}
+	rows := newFakeRows([]string{"id"}, []any{1}, []any{2}, []any{3})
+	seq, err := ScanIter[item](rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for v, err := range seq {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, v.ID)
+		if len(ids) == 2 {
+			break
+		}
+	}
+	if !slices.Equal(ids, []int{1, 2}) || !rows.closed {
+		t.Errorf("ids = %v, closed = %t", ids, rows.closed)
+	}
+
+	errIterate := errors.New("connection reset")
+	rows = newFakeRows([]string{"id"}, []any{1})
+	rows.err = errIterate
+	seq, _ = ScanIter[item](rows)
+	var errs []error
+	for _, err := range seq {
+		errs = append(errs, err)
+	}
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], errIterate) {
+		t.Errorf("errors = %v", errs)
+	}
+
+	errScan := errors.New("cannot scan")
+	failing := func(pgx.CollectableRow) (int, error) { return 0, errScan }
+	ints, _ := ScanIterWith(failing)(newFakeRows([]string{"id"}, []any{1}, []any{2}))
+	errs = nil
+	for _, err := range ints {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errScan) {
+		t.Errorf("scan errors = %v", errs)
+	}
+}
+
+func TestLazyIter(t *testing.T) {
+	errExec := errors.New("exec failed")
+	var calls int
+	seq := lazyIter(func() (iter.Seq2[int, error], error) {
+		calls++
+		return nil, errExec
+	})
+	if calls != 0 {
+		t.Fatal("statement executed before iteration")
+	}
+	var errs []error
+	for _, err := range seq {
+		errs = append(errs, err)
+	}
+	if calls != 1 || len(errs) != 1 || !errors.Is(errs[0], errExec) {
+		t.Errorf("calls = %d, errors = %v", calls, errs)
+	}
+
+	executor := &fakeExecutor{results: []*fakeRows{newFakeRows([]string{"n"}, []any{1}, []any{2})}}
+	var got []int
+	for n, err := range NewStmtFactoryWith("SELECT n FROM numbers", MapScalar[int]).Iter(context.Background(), executor) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, n)
+	}
+	if !slices.Equal(got, []int{1, 2}) || len(executor.stmts) != 1 {
+		t.Errorf("got %v after %d statements", got, len(executor.stmts))
+	}
+}
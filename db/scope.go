@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/bomjdev/yetanother/query"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Scope holds mandatory column values, such as tenant_id, that every
+// statement executed under it is restricted to. Repository, SelectFactory and
+// the write helpers apply it where they build their statements, qualified by
+// their table: selects, updates and deletes get it ANDed into WHERE, inserts
+// get the columns set, and client filters on scoped columns are dropped.
+// Statements that cannot be scoped, including raw SQL, fail with ErrUnscoped
+// unless run with Unscoped.
+type Scope map[string]any
+
+type (
+	scopeKey struct{}
+
+	// scopedSqlizer marks a statement the scope was applied to when it was
+	// built.
+	scopedSqlizer struct {
+		squirrel.Sqlizer
+	}
+)
+
+var ErrUnscoped = errors.New("statement cannot be scoped")
+
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	merged := maps.Clone(ScopeFrom(ctx))
+	if merged == nil {
+		merged = make(Scope, len(scope))
+	}
+	maps.Copy(merged, scope)
+	return context.WithValue(ctx, scopeKey{}, merged)
+}
+
+func ScopeFrom(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+	return scope
+}
+
+// Unscoped returns ctx without a scope, for statements that do not touch
+// scoped data or that restrict themselves to it.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, Scope(nil))
+}
+
+// BuildQuery is BuildQuery with the scope applied. The statement must be run
+// with Unscoped.
+func (s Scope) BuildQuery(query query.Query, builder squirrel.SelectBuilder) (string, []any, error) {
+	b, err := buildQuery(s.Query(query), builder)
+	if err != nil {
+		return "", nil, err
+	}
+	return s.selectWhere(b, "").ToSql()
+}
+
+// Query returns query without client filters on scoped columns.
+func (s Scope) Query(query query.Query) query.Query {
+	if len(s) == 0 || len(query.Filters) == 0 {
+		return query
+	}
+	filters := maps.Clone(query.Filters)
+	for column := range filters {
+		if s.scoped(column) {
+			delete(filters, column)
+		}
+	}
+	query.Filters = filters
+	return query
+}
+
+// Where returns the scope predicate with its columns qualified by qualifier,
+// when set, so that it stays unambiguous in joins.
+func (s Scope) Where(qualifier string) squirrel.Eq {
+	eq := make(squirrel.Eq, len(s))
+	for key, value := range s {
+		if qualifier != "" {
+			key = qualifier + "." + unqualified(key)
+		}
+		eq[key] = value
+	}
+	return eq
+}
+
+// Apply restricts a select, update or delete builder to the scope, with the
+// columns as given in the scope. Other statements, inserts included, fail
+// with ErrUnscoped.
+func (s Scope) Apply(sqlizer squirrel.Sqlizer) (squirrel.Sqlizer, error) {
+	if len(s) == 0 {
+		return sqlizer, nil
+	}
+	switch b := sqlizer.(type) {
+	case scopedSqlizer:
+		return b, nil
+	case squirrel.SelectBuilder:
+		return s.selectWhere(b, ""), nil
+	case squirrel.DeleteBuilder:
+		return b.Where(s.Where("")), nil
+	case squirrel.UpdateBuilder:
+		return b.Where(s.Where("")), nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnscoped, sqlizer)
+	}
+}
+
+func (s Scope) scoped(column string) bool {
+	for key := range s {
+		if unqualified(key) == unqualified(column) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scope) selectWhere(b squirrel.SelectBuilder, qualifier string) squirrel.SelectBuilder {
+	if len(s) == 0 {
+		return b
+	}
+	return b.Where(s.Where(qualifier))
+}
+
+// values sets the scope columns on every row, replacing the values given.
+func (s Scope) values(columns []string, rows [][]any) ([]string, [][]any) {
+	if len(s) == 0 {
+		return columns, rows
+	}
+	columns = slices.Clone(columns)
+	rows = slices.Clone(rows)
+	for r := range rows {
+		rows[r] = slices.Clone(rows[r])
+	}
+	for _, key := range slices.Sorted(maps.Keys(s)) {
+		column := unqualified(key)
+		i := slices.Index(columns, column)
+		if i < 0 {
+			columns = append(columns, column)
+		}
+		for r := range rows {
+			if i < 0 {
+				rows[r] = append(rows[r], s[key])
+			} else {
+				rows[r][i] = s[key]
+			}
+		}
+	}
+	return columns, rows
+}
+
+// conflictWhere restricts ON CONFLICT DO UPDATE on table to rows within the
+// scope: a conflicting row of another scope is left alone.
+func (s Scope) conflictWhere(b squirrel.InsertBuilder, table string) squirrel.InsertBuilder {
+	if len(s) == 0 {
+		return b
+	}
+	return b.SuffixExpr(squirrel.ConcatExpr("WHERE ", s.Where(table)))
+}
+
+// checkScope fails closed for raw statements run under a scope.
+func checkScope(ctx context.Context) error {
+	if len(ScopeFrom(ctx)) > 0 {
+		return fmt.Errorf("%w: raw statement", ErrUnscoped)
+	}
+	return nil
+}
+
+func scoped(sqlizer squirrel.Sqlizer) squirrel.Sqlizer {
+	return scopedSqlizer{sqlizer}
+}
+
+func unqualified(column string) string {
+	return column[strings.LastIndexByte(column, '.')+1:]
+}
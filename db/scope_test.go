@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/Masterminds/squirrel"
+	"github.com/bomjdev/yetanother/query"
+	"github.com/jackc/pgx/v5/pgconn"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type scopeTestAccount struct {
+	ID       int64  `db:"id,pk"`
+	TenantID int64  `db:"tenant_id"`
+	Name     string `db:"name"`
+}
+
+func TestScopeBuildQuery(t *testing.T) {
+	scope := Scope{"tenant_id": 7}
+	q := query.Query{Filters: map[string][]query.Filter{
+		"tenant_id": {{Value: "8"}},
+		"name":      {{Value: "a"}},
+	}}
+	sql, args, err := scope.BuildQuery(q, Postgres.Select("id").From("users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT id FROM users WHERE (name = $1) AND tenant_id = $2"; sql != want {
+		t.Errorf("sql = %q, want %q", sql, want)
+	}
+	if !slices.Equal(args, []any{"a", 7}) {
+		t.Errorf("args = %v", args)
+	}
+	if len(q.Filters) != 2 {
+		t.Error("client query modified")
+	}
+}
+
+func TestScopeApply(t *testing.T) {
+	scope := Scope{"tenant_id": 7}
+	type testCase struct {
+		scope   Scope
+		builder squirrel.Sqlizer
+		sql     string
+		args    []any
+	}
+	for _, tc := range []testCase{
+		{
+			scope:   Scope{"users.tenant_id": 7},
+			builder: Postgres.Select("users.id").From("users").Join("orgs ON orgs.id = users.org_id"),
+			sql:     "SELECT users.id FROM users JOIN orgs ON orgs.id = users.org_id WHERE users.tenant_id = $1",
+			args:    []any{7},
+		},
+		{
+			scope:   scope,
+			builder: Postgres.Update("users").Set("name", "a").Where(squirrel.Eq{"id": 1}),
+			sql:     "UPDATE users SET name = $1 WHERE id = $2 AND tenant_id = $3",
+			args:    []any{"a", 1, 7},
+		},
+		{
+			scope:   scope,
+			builder: Postgres.Update("users").Set("tenant_id", 7).Where(squirrel.Eq{"id": 1}),
+			sql:     "UPDATE users SET tenant_id = $1 WHERE id = $2 AND tenant_id = $3",
+			args:    []any{7, 1, 7},
+		},
+		{
+			scope:   scope,
+			builder: Postgres.Delete("users").Where(squirrel.Eq{"id": 1}),
+			sql:     "DELETE FROM users WHERE id = $1 AND tenant_id = $2",
+			args:    []any{1, 7},
+		},
+		{
+			scope:   scope,
+			builder: scoped(Postgres.Insert("users").Columns("name").Values("a")),
+			sql:     "INSERT INTO users (name) VALUES ($1)",
+			args:    []any{"a"},
+		},
+		{
+			builder: squirrel.Expr("SELECT 1"),
+			sql:     "SELECT 1",
+			args:    nil,
+		},
+	} {
+		sqlizer, err := tc.scope.Apply(tc.builder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, args, err := sqlizer.ToSql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != tc.sql || !slices.Equal(args, tc.args) {
+			t.Errorf("got %q %v\nwant %q %v", sql, args, tc.sql, tc.args)
+		}
+	}
+
+	for _, sqlizer := range []squirrel.Sqlizer{
+		squirrel.Expr("SELECT 1"),
+		Postgres.Insert("users").Columns("name").Values("a"),
+		Postgres.Insert("users").Select(Postgres.Select("1")),
+	} {
+		if _, err := scope.Apply(sqlizer); !errors.Is(err, ErrUnscoped) {
+			t.Errorf("%T: %v", sqlizer, err)
+		}
+	}
+}
+
+func TestScopeRaw(t *testing.T) {
+	ctx := WithScope(context.Background(), Scope{"tenant_id": 7})
+	executor := &fakeExecutor{}
+	if _, err := Exec(ctx, executor, "DELETE FROM users"); !errors.Is(err, ErrUnscoped) {
+		t.Errorf("raw statement: %v", err)
+	}
+	if _, err := NewStmtFactory[scopeTestAccount]("SELECT * FROM accounts").Scan(ctx, executor); !errors.Is(err, ErrUnscoped) {
+		t.Errorf("statement factory: %v", err)
+	}
+	if _, err := Exec.WithBuilder(squirrel.Expr("SELECT 1"))(ctx, executor); !errors.Is(err, ErrUnscoped) {
+		t.Errorf("expression: %v", err)
+	}
+	if len(executor.stmts) != 0 {
+		t.Fatalf("unscoped statements run: %v", executor.stmts)
+	}
+
+	ctx = Unscoped(ctx)
+	if _, err := Exec(ctx, executor, "DELETE FROM users WHERE tenant_id = $1", 7); err != nil {
+		t.Error(err)
+	}
+	if _, err := Exec.WithBuilder(squirrel.Expr("SELECT 1"))(ctx, executor); err != nil {
+		t.Error(err)
+	}
+	if len(executor.stmts) != 2 {
+		t.Errorf("statements = %v", executor.stmts)
+	}
+}
+
+func TestScopeSelectFactory(t *testing.T) {
+	ctx := WithScope(context.Background(), Scope{"tenant_id": 7})
+	executor := &fakeExecutor{}
+	factory := GetRows.SelectFactoryFor("users", Postgres.Select("users.id").From("users").Join("orgs ON orgs.id = users.org_id"))
+	exec, err := factory(query.Query{Filters: map[string][]query.Filter{
+		"tenant_id":  {{Value: "8"}},
+		"users.name": {{Value: "a"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = exec(ctx, executor); err != nil {
+		t.Fatal(err)
+	}
+	stmt := executor.stmts[0]
+	if want := "SELECT users.id FROM users JOIN orgs ON orgs.id = users.org_id WHERE (users.name = $1) AND users.tenant_id = $2"; stmt.sql != want || !slices.Equal(stmt.args, []any{"a", 7}) {
+		t.Errorf("got %q %v, want %q", stmt.sql, stmt.args, want)
+	}
+}
+
+func TestScopeWrites(t *testing.T) {
+	ctx := WithScope(context.Background(), Scope{"tenant_id": int64(7)})
+	executor := &fakeExecutor{}
+
+	insert, err := InsertReturning("accounts", scopeTestAccount{Name: "a", TenantID: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = insert(ctx, executor); err != nil {
+		t.Fatal(err)
+	}
+	update, err := UpdateExec("accounts", scopeTestAccount{ID: 1, Name: "b", TenantID: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.tag = pgconn.NewCommandTag("UPDATE 1")
+	if _, err = update(ctx, executor); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []fakeStmt{
+		{sql: "INSERT INTO accounts (tenant_id,name) VALUES ($1,$2) RETURNING *", args: []any{int64(7), "a"}},
+		{sql: "UPDATE accounts SET name = $1 WHERE id = $2 AND accounts.tenant_id = $3", args: []any{"b", int64(1), int64(7)}},
+	} {
+		if got := executor.stmts[i]; got.sql != want.sql || !slices.Equal(got.args, want.args) {
+			t.Errorf("got %q %v\nwant %q %v", got.sql, got.args, want.sql, want.args)
+		}
+	}
+
+	if _, err = Exec.WithBuilder(Postgres.Insert("accounts").Columns("name").Values("c"))(ctx, executor); !errors.Is(err, ErrUnscoped) {
+		t.Errorf("insert builder: %v", err)
+	}
+}
+
+func TestScopeCopy(t *testing.T) {
+	ctx := WithScope(context.Background(), Scope{"tenant_id": int64(7)})
+	copier := &fakeCopier{}
+	if _, err := CopyFromSlice(ctx, copier, "accounts", []scopeTestAccount{{Name: "a", TenantID: 8}}, CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(copier.columns, []string{"tenant_id", "name"}) || copier.copied[0][0] != int64(7) {
+		t.Errorf("copied %v: %v", copier.columns, copier.copied)
+	}
+
+	root := &fakeTx{}
+	copier = &fakeCopier{tx: root}
+	if _, err := CopyFromSlice(ctx, copier, "items", []copyItem{{ID: 1, Name: "a"}}, CopyOptions{Conflict: []string{"id"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.execs) != 3 || root.copied[0][2] != int64(7) {
+		t.Fatalf("statements %v, copied %v", root.execs, root.copied)
+	}
+	merge := root.execs[1]
+	if want := " ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, tenant_id = EXCLUDED.tenant_id WHERE items.tenant_id = $1"; !strings.HasSuffix(merge[0].(string), want) || !slices.Equal(merge[1:], []any{int64(7)}) {
+		t.Errorf("merge = %v, want suffix %q", merge, want)
+	}
+}
+
+func TestScopeBatch(t *testing.T) {
+	ctx := WithScope(context.Background(), Scope{"tenant_id": 7})
+	b := NewBatch()
+	count := BatchBuilder(b, ScanExactlyOneWith(MapScalar[int64]), Postgres.Select("count(*)").From("users"))
+	sender := &fakeBatchSender{replies: []batchReply{{rows: newFakeRows([]string{"count"}, []any{int64(2)})}}}
+	if err := b.Send(ctx, sender); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := count.Value(); err != nil || n != 2 || sender.sent[0] != "SELECT count(*) FROM users WHERE tenant_id = $1" {
+		t.Errorf("count = %d, %v, sent %q", n, err, sender.sent)
+	}
+
+	raw := BatchExec(b, "DELETE FROM users")
+	sender = &fakeBatchSender{replies: make([]batchReply, 2)}
+	if err := b.Send(ctx, sender); !errors.Is(err, ErrUnscoped) {
+		t.Fatalf("send = %v", err)
+	}
+	if _, err := raw.Value(); !errors.Is(err, ErrUnscoped) || len(sender.sent) != 0 {
+		t.Errorf("raw = %v, sent %q", err, sender.sent)
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	ctx := WithScope(context.Background(), Scope{"tenant_id": 1})
+	ctx = WithScope(ctx, Scope{"org_id": 2})
+	if scope := ScopeFrom(ctx); len(scope) != 2 || scope["tenant_id"] != 1 {
+		t.Errorf("scope = %v", scope)
+	}
+	if scope := ScopeFrom(Unscoped(ctx)); len(scope) != 0 {
+		t.Errorf("unscoped = %v", scope)
+	}
+}
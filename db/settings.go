@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"maps"
+	"slices"
+	"time"
+)
+
+type (
+	settingsKey struct{}
+
+	// settingsRows releases the connection its settings were applied to
+	// once the rows are closed or exhausted.
+	settingsRows struct {
+		pgx.Rows
+		release func()
+	}
+)
+
+const resetTimeout = 5 * time.Second
+
+// WithSettings returns a context carrying session settings, such as
+// app.tenant_id for row-level security policies, merged over those already in
+// ctx. They are applied with set_config at the start of every transaction and,
+// by PGX, around every statement run outside one or in a transaction it did
+// not begin with them.
+func WithSettings(ctx context.Context, settings map[string]string) context.Context {
+	merged := maps.Clone(SettingsFrom(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(settings))
+	}
+	maps.Copy(merged, settings)
+	return context.WithValue(ctx, settingsKey{}, merged)
+}
+
+func SettingsFrom(ctx context.Context) map[string]string {
+	settings, _ := ctx.Value(settingsKey{}).(map[string]string)
+	return settings
+}
+
+func applySettings(ctx context.Context, executor Executor, settings map[string]string, local bool) error {
+	if len(settings) == 0 {
+		return nil
+	}
+	keys := slices.Sorted(maps.Keys(settings))
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = settings[key]
+	}
+	_, err := executor.Exec(ctx, "SELECT set_config(k, v, $3) FROM unnest($1::text[], $2::text[]) AS s(k, v)", keys, values, local)
+	return err
+}
+
+// currentSettings returns the values the keys of settings have in tx, empty
+// for unset ones, so that a savepoint can restore them before it is released:
+// local settings otherwise outlive the savepoint until the outer commit.
+func currentSettings(ctx context.Context, tx Executor, settings map[string]string) (map[string]string, error) {
+	keys := slices.Sorted(maps.Keys(settings))
+	var values []string
+	if err := tx.QueryRow(ctx, `
+		SELECT array_agg(coalesce(current_setting(k, true), '') ORDER BY i)
+		FROM unnest($1::text[]) WITH ORDINALITY AS s(k, i)`,
+		keys,
+	).Scan(&values); err != nil {
+		return nil, err
+	}
+	current := make(map[string]string, len(keys))
+	for i, key := range keys {
+		current[key] = values[i]
+	}
+	return current, nil
+}
+
+// txSettings applies the ctx settings locally in tx for a single statement,
+// since tx was not necessarily begun with them, and returns a func restoring
+// the values they had. It returns nil when ctx carries no settings.
+func txSettings(ctx context.Context, tx pgx.Tx) (func() error, error) {
+	settings := SettingsFrom(ctx)
+	if len(settings) == 0 {
+		return nil, nil
+	}
+	previous, err := currentSettings(ctx, tx, settings)
+	if err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+	if err = applySettings(ctx, tx, settings, true); err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+	return func() error {
+		if err := applySettings(ctx, tx, previous, true); err != nil {
+			return fmt.Errorf("restore settings: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// execTx runs a statement in tx with the ctx settings applied.
+func execTx(ctx context.Context, tx pgx.Tx, sql string, args ...any) (pgconn.CommandTag, error) {
+	restore, err := txSettings(ctx, tx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	if restore == nil {
+		return tx.Exec(ctx, sql, args...)
+	}
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		_ = restore()
+		return tag, err
+	}
+	return tag, restore()
+}
+
+// queryTx runs a query in tx with the ctx settings applied until the rows
+// are closed.
+func queryTx(ctx context.Context, tx pgx.Tx, sql string, args ...any) (pgx.Rows, error) {
+	restore, err := txSettings(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if restore == nil {
+		return tx.Query(ctx, sql, args...)
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		_ = restore()
+		return nil, err
+	}
+	return &settingsRows{Rows: rows, release: func() { _ = restore() }}, nil
+}
+
+// acquireWithSettings returns a connection from pool with settings applied
+// for the session. It must be given back with releaseSettings.
+func acquireWithSettings(ctx context.Context, pool *pgxpool.Pool, settings map[string]string) (*pgxpool.Conn, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = applySettings(ctx, conn, settings, false); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+	return conn, nil
+}
+
+// releaseSettings resets settings to their defaults and returns conn to the pool, closing it
+// instead when the reset fails so that no other caller inherits them.
+func releaseSettings(conn *pgxpool.Conn, settings map[string]string) {
+	ctx, cancel := context.WithTimeout(context.Background(), resetTimeout)
+	defer cancel()
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		if _, err := conn.Exec(ctx, "RESET "+pgx.Identifier{key}.Sanitize()); err != nil {
+			_ = conn.Conn().Close(ctx)
+			break
+		}
+	}
+	conn.Release()
+}
+
+// queryPool runs a query on pool with the ctx settings applied.
+func queryPool(ctx context.Context, pool *pgxpool.Pool, sql string, args ...any) (pgx.Rows, error) {
+	settings := SettingsFrom(ctx)
+	if len(settings) == 0 {
+		return pool.Query(ctx, sql, args...)
+	}
+	conn, err := acquireWithSettings(ctx, pool, settings)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		releaseSettings(conn, settings)
+		return nil, err
+	}
+	return &settingsRows{Rows: rows, release: func() { releaseSettings(conn, settings) }}, nil
+}
+
+func (r *settingsRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.Close()
+	return false
+}
+
+func (r *settingsRows) Close() {
+	r.Rows.Close()
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+}
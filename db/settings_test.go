@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunInTransactionSettings(t *testing.T) {
+	ctx := WithSettings(context.Background(), map[string]string{"app.tenant_id": "1", "app.user_id": "7"})
+	ctx = WithSettings(ctx, map[string]string{"app.tenant_id": "2"})
+
+	tx := &fakeTx{}
+	if err := RunInTransaction(ctx, fakeBeginner{tx: tx}, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.execs) != 1 {
+		t.Fatalf("execs = %v", tx.execs)
+	}
+	want := []any{[]string{"app.tenant_id", "app.user_id"}, []string{"2", "7"}, true}
+	if got := tx.execs[0][1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("set_config args = %v, want %v", got, want)
+	}
+
+	tx = &fakeTx{}
+	if err := RunInTransaction(context.Background(), fakeBeginner{tx: tx}, func(pgx.Tx) error { return nil }); err != nil || len(tx.execs) != 0 {
+		t.Errorf("settings applied without context values: %v, %v", tx.execs, err)
+	}
+}
+
+func TestRunInTransactionSettingsSavepoint(t *testing.T) {
+	ctx := WithSettings(context.Background(), map[string]string{"app.tenant_id": "2", "app.user_id": "7"})
+	root := &fakeTx{current: []string{"1", ""}}
+	if err := RunInTransaction(ctx, root, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.begun) != 1 {
+		t.Fatalf("savepoints = %d", len(root.begun))
+	}
+	execs := root.begun[0].execs
+	if len(execs) != 2 {
+		t.Fatalf("execs = %v", execs)
+	}
+	keys := []string{"app.tenant_id", "app.user_id"}
+	if got, want := execs[0][1:], []any{keys, []string{"2", "7"}, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("set_config args = %v, want %v", got, want)
+	}
+	if got, want := execs[1][1:], []any{keys, []string{"1", ""}, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("restore args = %v, want %v", got, want)
+	}
+
+	root = &fakeTx{current: []string{"1", ""}}
+	errFn := errors.New("fn failed")
+	if err := RunInTransaction(ctx, root, func(pgx.Tx) error { return errFn }); !errors.Is(err, errFn) {
+		t.Fatalf("err = %v", err)
+	}
+	if savepoint := root.begun[0]; len(savepoint.execs) != 1 || !savepoint.rolledBack {
+		t.Errorf("rolled back savepoint execs = %v, rolled back %t", savepoint.execs, savepoint.rolledBack)
+	}
+}
+
+func TestSettingsUnreachable(t *testing.T) {
+	p := New(newTestPoolPort(t, "127.0.0.1", 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = WithSettings(ctx, map[string]string{"app.tenant_id": "1"})
+
+	if _, err := p.Exec(ctx, "SELECT 1"); err == nil {
+		t.Error("Exec succeeded without a server")
+	}
+	if _, err := p.Query(ctx, "SELECT 1"); err == nil {
+		t.Error("Query succeeded without a server")
+	}
+	var n int
+	if err := p.QueryRow(ctx, "SELECT 1").Scan(&n); err == nil {
+		t.Error("QueryRow succeeded without a server")
+	}
+}
+
+func TestSettingsRowsRelease(t *testing.T) {
+	var released int
+	rows := &settingsRows{
+		Rows:    newFakeRows([]string{"n"}, []any{1}),
+		release: func() { released++ },
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	if released != 1 {
+		t.Errorf("released %d times, want 1", released)
+	}
+}
+
+func TestPGXTxSettings(t *testing.T) {
+	ctx := WithSettings(context.Background(), map[string]string{"app.tenant_id": "2", "app.user_id": "7"})
+	root := &fakeTx{current: []string{"1", ""}, columns: []string{"n"}, rows: [][]any{{1}}}
+	p := PGX{}.WithTx(root)
+	if _, err := p.Exec(ctx, "DELETE FROM items"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := p.Query(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if _, err = p.Exec(context.Background(), "DELETE FROM items"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{"app.tenant_id", "app.user_id"}
+	set, restore := []any{keys, []string{"2", "7"}, true}, []any{keys, []string{"1", ""}, true}
+	if len(root.execs) != 6 || root.queried != 1 {
+		t.Fatalf("execs = %v, queried %d", root.execs, root.queried)
+	}
+	for i, want := range [][]any{set, {}, restore, set, restore, {}} {
+		if got := root.execs[i][1:]; !reflect.DeepEqual(got, want) {
+			t.Errorf("exec %d args = %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"io/fs"
+	"iter"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// NamedStmt is a statement loaded from an annotated .sql file. SQL has
+	// named parameters rewritten to $n; Params holds the name bound to each $n.
+	NamedStmt struct {
+		Name   string
+		Kind   string
+		File   string
+		Source string
+		SQL    string
+		Params []string
+	}
+
+	Statements map[string]NamedStmt
+
+	Preparer interface {
+		Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error)
+	}
+
+	NamedScanner[T any] struct {
+		stmt    NamedStmt
+		scanner StmtScanner[T]
+	}
+)
+
+var nameAnnotation = regexp.MustCompile(`^--\s*name:\s*(\S+)(?:\s+(:\S+))?\s*$`)
+
+// LoadStatements parses every file in fsys matching pattern into a registry.
+// Statement names must be unique across files.
+func LoadStatements(fsys fs.FS, pattern string) (Statements, error) {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	statements := make(Statements)
+	for _, file := range files {
+		text, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		stmts, err := ParseStatements(file, string(text))
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range stmts {
+			if prev, ok := statements[stmt.Name]; ok {
+				return nil, fmt.Errorf("%s: statement %q already defined in %s", file, stmt.Name, prev.File)
+			}
+			statements[stmt.Name] = stmt
+		}
+	}
+	return statements, nil
+}
+
+// ParseStatements splits text on "-- name: X [:kind]" lines. Anything before
+// the first annotation is ignored.
+func ParseStatements(file, text string) ([]NamedStmt, error) {
+	var (
+		stmts []NamedStmt
+		body  strings.Builder
+		cur   *NamedStmt
+	)
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		cur.Source = strings.TrimRight(strings.TrimSpace(body.String()), ";")
+		if cur.Source == "" {
+			return fmt.Errorf("%s: statement %q is empty", file, cur.Name)
+		}
+		var err error
+		if cur.SQL, cur.Params, err = compileNamed(cur.Source); err != nil {
+			return fmt.Errorf("%s: statement %q: %w", file, cur.Name, err)
+		}
+		stmts = append(stmts, *cur)
+		return nil
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if m := nameAnnotation.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			cur = &NamedStmt{Name: m[1], Kind: m[2], File: file}
+			body.Reset()
+			continue
+		}
+		body.WriteString(line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return stmts, nil
+}
+
+func (s Statements) Get(name string) (NamedStmt, error) {
+	stmt, ok := s[name]
+	if !ok {
+		return NamedStmt{}, fmt.Errorf("unknown statement %q", name)
+	}
+	return stmt, nil
+}
+
+// Validate prepares every statement as an unnamed statement so that syntax
+// errors and unknown relations surface at startup.
+func (s Statements) Validate(ctx context.Context, preparer Preparer) error {
+	var errs []error
+	for name, stmt := range s {
+		if _, err := preparer.Prepare(ctx, "", stmt.SQL); err != nil {
+			errs = append(errs, fmt.Errorf("%s: statement %q: %w", stmt.File, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Bind returns the positional arguments for params, a struct (or pointer to
+// one) matched by db tags, or a map with string keys.
+func (s NamedStmt) Bind(params any) ([]any, error) {
+	if len(s.Params) == 0 {
+		return nil, nil
+	}
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	args := make([]any, len(s.Params))
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		for i, name := range s.Params {
+			arg := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !arg.IsValid() {
+				return nil, fmt.Errorf("statement %q: missing parameter %q", s.Name, name)
+			}
+			args[i] = arg.Interface()
+		}
+	case v.Kind() == reflect.Struct:
+		fs, err := typeFields(v.Type())
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range s.Params {
+			f, ok := fs.byName(name)
+			if !ok {
+				return nil, fmt.Errorf("statement %q: %s has no field for parameter %q", s.Name, v.Type(), name)
+			}
+			args[i] = f.value(v).Interface()
+		}
+	default:
+		return nil, fmt.Errorf("statement %q: cannot bind parameters from %T", s.Name, params)
+	}
+	return args, nil
+}
+
+func (s NamedStmt) Exec(ctx context.Context, executor Executor, params any) (pgconn.CommandTag, error) {
+	args, err := s.Bind(params)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return Exec(ctx, executor, s.SQL, args...)
+}
+
+func NewNamedScanner[T any](stmt NamedStmt) NamedScanner[T] {
+	return NewNamedScannerWith(stmt, MapByName[T])
+}
+
+func NewNamedScannerWith[T any](stmt NamedStmt, mapper RowMapper[T]) NamedScanner[T] {
+	return NamedScanner[T]{stmt: stmt, scanner: NewStmtFactoryWith(stmt.SQL, mapper)}
+}
+
+func (s NamedScanner[T]) Scan(ctx context.Context, executor Executor, params any) ([]T, error) {
+	args, err := s.stmt.Bind(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanner.Scan(ctx, executor, args...)
+}
+
+func (s NamedScanner[T]) ScanOne(ctx context.Context, executor Executor, params any) (T, error) {
+	args, err := s.stmt.Bind(params)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return s.scanner.ScanOne(ctx, executor, args...)
+}
+
+func (s NamedScanner[T]) ScanExactlyOne(ctx context.Context, executor Executor, params any) (T, error) {
+	args, err := s.stmt.Bind(params)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return s.scanner.ScanExactlyOne(ctx, executor, args...)
+}
+
+func (s NamedScanner[T]) Iter(ctx context.Context, executor Executor, params any) iter.Seq2[T, error] {
+	return lazyIter(func() (iter.Seq2[T, error], error) {
+		args, err := s.stmt.Bind(params)
+		if err != nil {
+			return nil, err
+		}
+		return s.scanner.iter(ctx, executor, args...)
+	})
+}
+
+// compileNamed rewrites :name and @name parameters to $n, leaving string
+// literals, quoted identifiers, comments, dollar-quoted bodies and :: casts
+// untouched. A repeated name reuses its placeholder.
+func compileNamed(sql string) (string, []string, error) {
+	var (
+		b          strings.Builder
+		params     []string
+		positions  = make(map[string]int)
+		positional bool
+	)
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		next := byte(0)
+		if i+1 < len(sql) {
+			next = sql[i+1]
+		}
+		var end int
+		switch {
+		case c == '\'':
+			escapes := i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i < 2 || !isIdentChar(sql[i-2]))
+			end = skipQuoted(sql, i, '\'', escapes)
+		case c == '"':
+			end = skipQuoted(sql, i, '"', false)
+		case c == '-' && next == '-':
+			if end = strings.IndexByte(sql[i:], '\n'); end < 0 {
+				end = len(sql)
+			} else {
+				end += i + 1
+			}
+		case c == '/' && next == '*':
+			end = skipBlockComment(sql, i)
+		case c == '$' && isDigit(next):
+			positional = true
+			end = i + 1
+		case c == '$' && (next == '$' || isIdentStart(next)) && (i == 0 || !isIdentChar(sql[i-1])):
+			end = skipDollarQuoted(sql, i)
+		case c == ':' && next == ':':
+			end = i + 2
+		case (c == ':' || c == '@') && isIdentStart(next) && (i == 0 || !isIdentChar(sql[i-1])):
+			j := i + 1
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			name := sql[i+1 : j]
+			n, ok := positions[name]
+			if !ok {
+				params = append(params, name)
+				n = len(params)
+				positions[name] = n
+			}
+			b.WriteString("$" + strconv.Itoa(n))
+			i = j
+			continue
+		default:
+			end = i + 1
+		}
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated %q at offset %d", sql[i:min(i+2, len(sql))], i)
+		}
+		b.WriteString(sql[i:end])
+		i = end
+	}
+	if positional && len(params) > 0 {
+		return "", nil, errors.New("cannot mix named and positional parameters")
+	}
+	return b.String(), params, nil
+}
+
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch sql[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return -1
+}
+
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for j := i; j+1 < len(sql); j++ {
+		switch {
+		case sql[j] == '/' && sql[j+1] == '*':
+			depth++
+			j++
+		case sql[j] == '*' && sql[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// skipDollarQuoted skips $tag$...$tag$. A '$' not opening a valid tag is
+// treated as an ordinary character.
+func skipDollarQuoted(sql string, i int) int {
+	j := i + 1
+	for j < len(sql) && (isIdentStart(sql[j]) || isDigit(sql[j])) {
+		j++
+	}
+	if j >= len(sql) || sql[j] != '$' {
+		return i + 1
+	}
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return -1
+	}
+	return j + 1 + end + len(tag)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
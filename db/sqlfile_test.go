@@ -0,0 +1,102 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompileNamed(t *testing.T) {
+	type testCase struct {
+		sql    string
+		want   string
+		params []string
+		err    bool
+	}
+	for _, tc := range []testCase{
+		{
+			sql:    "SELECT * FROM users WHERE id = :id AND org = @org OR owner = :id",
+			want:   "SELECT * FROM users WHERE id = $1 AND org = $2 OR owner = $1",
+			params: []string{"id", "org"},
+		},
+		{
+			sql:    "SELECT ':skip', \"@skip\", E'\\':skip', created_at::date FROM t WHERE a = :a::int",
+			want:   "SELECT ':skip', \"@skip\", E'\\':skip', created_at::date FROM t WHERE a = $1::int",
+			params: []string{"a"},
+		},
+		{
+			sql:    "SELECT 1 -- :skip\n/* :skip /* @nested */ */ FROM t WHERE b = :b",
+			want:   "SELECT 1 -- :skip\n/* :skip /* @nested */ */ FROM t WHERE b = $1",
+			params: []string{"b"},
+		},
+		{
+			sql:    "SELECT $fn$ :skip $$ $fn$, $$ @skip $$, arr[1:n], tags @> :tags",
+			want:   "SELECT $fn$ :skip $$ $fn$, $$ @skip $$, arr[1:n], tags @> $1",
+			params: []string{"tags"},
+		},
+		{sql: "SELECT * FROM t WHERE id = $1", want: "SELECT * FROM t WHERE id = $1"},
+		{sql: "SELECT * FROM t WHERE id = $1 AND a = :a", err: true},
+		{sql: "SELECT 'unterminated", err: true},
+		{sql: "SELECT $x$ body", err: true},
+	} {
+		got, params, err := compileNamed(tc.sql)
+		if (err != nil) != tc.err {
+			t.Errorf("compileNamed(%q) error = %v", tc.sql, err)
+			continue
+		}
+		if got != tc.want || !slices.Equal(params, tc.params) {
+			t.Errorf("compileNamed(%q) = %q %v, want %q %v", tc.sql, got, params, tc.want, tc.params)
+		}
+	}
+}
+
+func TestLoadStatements(t *testing.T) {
+	fsys := fstest.MapFS{
+		"queries/users.sql": {Data: []byte(`-- users queries
+
+-- name: GetUser :one
+SELECT id, name FROM users
+WHERE id = :id;
+
+-- name: RenameUser :exec
+UPDATE users SET name = @name WHERE id = @id;
+`)},
+		"queries/orgs.sql": {Data: []byte("-- name: ListOrgs\nSELECT * FROM orgs\n")},
+	}
+	statements, err := LoadStatements(fsys, "queries/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 3 {
+		t.Fatalf("loaded %d statements", len(statements))
+	}
+
+	get, _ := statements.Get("GetUser")
+	if get.Kind != ":one" || get.SQL != "SELECT id, name FROM users\nWHERE id = $1" || get.File != "queries/users.sql" {
+		t.Errorf("GetUser = %+v", get)
+	}
+
+	rename, _ := statements.Get("RenameUser")
+	args, err := rename.Bind(struct {
+		ID   int64
+		Name string `db:"name"`
+	}{ID: 1, Name: "a"})
+	if err != nil || !slices.Equal(args, []any{"a", int64(1)}) {
+		t.Errorf("bind struct = %v, %v", args, err)
+	}
+	if args, err = rename.Bind(map[string]any{"id": 2, "name": "b"}); err != nil || !slices.Equal(args, []any{"b", 2}) {
+		t.Errorf("bind map = %v, %v", args, err)
+	}
+	if _, err = rename.Bind(map[string]any{"id": 2}); err == nil {
+		t.Error("missing parameter not reported")
+	}
+
+	if _, err = statements.Get("Missing"); err == nil {
+		t.Error("unknown statement not reported")
+	}
+
+	fsys["queries/dup.sql"] = &fstest.MapFile{Data: []byte("-- name: ListOrgs\nSELECT 1")}
+	if _, err = LoadStatements(fsys, "queries/*.sql"); err == nil {
+		t.Error("duplicate statement not reported")
+	}
+}
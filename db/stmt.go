@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"github.com/jackc/pgx/v5"
+	"iter"
 )
 
 type StmtExecFunc[T any] func(ctx context.Context, executor Executor, args ...any) (T, error)
@@ -24,32 +25,53 @@ func StmtWithScanner[T any](exec StmtExecFunc[pgx.Rows], scan ScanFunc[T]) StmtE
 	}
 }
 
+// StmtScanner reads may go to a replica, see WithReplica.
 type StmtScanner[T any] struct {
 	scan           StmtExecFunc[[]T]
 	scanOne        StmtExecFunc[T]
 	scanExactlyOne StmtExecFunc[T]
+	iter           StmtExecFunc[iter.Seq2[T, error]]
 }
 
 func NewStmtScanner[T any](factory StmtExecFunc[pgx.Rows]) StmtScanner[T] {
+	return NewStmtScannerWith(factory, MapByName[T])
+}
+
+func NewStmtScannerWith[T any](factory StmtExecFunc[pgx.Rows], mapper RowMapper[T]) StmtScanner[T] {
 	return StmtScanner[T]{
-		scan:           StmtWithScanner(factory, Scan[T]),
-		scanOne:        StmtWithScanner(factory, ScanOne[T]),
-		scanExactlyOne: StmtWithScanner(factory, ScanExactlyOne[T]),
+		scan:           StmtWithScanner(factory, ScanWith(mapper)),
+		scanOne:        StmtWithScanner(factory, ScanOneWith(mapper)),
+		scanExactlyOne: StmtWithScanner(factory, ScanExactlyOneWith(mapper)),
+		iter:           StmtWithScanner(factory, ScanIterWith(mapper)),
 	}
 }
 
 func (s StmtScanner[T]) Scan(ctx context.Context, executor Executor, args ...any) ([]T, error) {
+	ctx = WithReplica(ctx)
 	return s.scan(ctx, executor, args...)
 }
 
 func (s StmtScanner[T]) ScanOne(ctx context.Context, executor Executor, args ...any) (T, error) {
+	ctx = WithReplica(ctx)
 	return s.scanOne(ctx, executor, args...)
 }
 
 func (s StmtScanner[T]) ScanExactlyOne(ctx context.Context, executor Executor, args ...any) (T, error) {
+	ctx = WithReplica(ctx)
 	return s.scanExactlyOne(ctx, executor, args...)
 }
 
+func (s StmtScanner[T]) Iter(ctx context.Context, executor Executor, args ...any) iter.Seq2[T, error] {
+	ctx = WithReplica(ctx)
+	return lazyIter(func() (iter.Seq2[T, error], error) {
+		return s.iter(ctx, executor, args...)
+	})
+}
+
 func NewStmtFactory[T any](stmt string) StmtScanner[T] {
 	return NewStmtScanner[T](GetRows.WithStatement(stmt))
 }
+
+func NewStmtFactoryWith[T any](stmt string, mapper RowMapper[T]) StmtScanner[T] {
+	return NewStmtScannerWith(GetRows.WithStatement(stmt), mapper)
+}
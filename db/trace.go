@@ -0,0 +1,294 @@
+package db
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"log/slog"
+	"time"
+)
+
+type (
+	TxTracer interface {
+		TraceTxStart(ctx context.Context) context.Context
+		TraceTxEnd(ctx context.Context, err error)
+	}
+
+	Tracer interface {
+		Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+	}
+
+	Span interface {
+		SetAttributes(attrs ...slog.Attr)
+		RecordError(err error)
+		End()
+	}
+
+	LogOptions struct {
+		Level         slog.Level
+		SlowThreshold time.Duration
+		LogArgs       bool
+		Redact        func(args []any) []any
+	}
+
+	QueryLogger struct {
+		logger  *slog.Logger
+		options LogOptions
+	}
+
+	SpanTracer struct {
+		tracer Tracer
+	}
+
+	multiTracer []pgx.QueryTracer
+
+	traceStart struct {
+		at   time.Time
+		sql  string
+		args []any
+	}
+
+	startKey struct{ kind string }
+	spanKey  struct{ kind string }
+)
+
+func WithQueryLog(logger *slog.Logger, options LogOptions) Option {
+	return WithTracer(NewQueryLogger(logger, options))
+}
+
+func WithSpans(tracer Tracer) Option {
+	return WithTracer(NewSpanTracer(tracer))
+}
+
+func WithTracer(tracer pgx.QueryTracer) Option {
+	return func(o *options) {
+		o.tracers = append(o.tracers, tracer)
+	}
+}
+
+func NewQueryLogger(logger *slog.Logger, options LogOptions) QueryLogger {
+	return QueryLogger{logger: logger, options: options}
+}
+
+func (l QueryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, startKey{"query"}, traceStart{at: time.Now(), sql: data.SQL, args: data.Args})
+}
+
+func (l QueryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start := started(ctx, "query")
+	l.log(ctx, "query", start.at, data.Err,
+		slog.String("sql", start.sql),
+		l.args(start.args),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	)
+}
+
+func (l QueryLogger) TraceBatchStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceBatchStartData) context.Context {
+	return context.WithValue(ctx, startKey{"batch"}, traceStart{at: time.Now()})
+}
+
+func (l QueryLogger) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	l.log(ctx, "batch query", time.Time{}, data.Err,
+		slog.String("sql", data.SQL),
+		l.args(data.Args),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	)
+}
+
+func (l QueryLogger) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	l.log(ctx, "batch", started(ctx, "batch").at, data.Err)
+}
+
+func (l QueryLogger) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return context.WithValue(ctx, startKey{"copy"}, traceStart{at: time.Now(), sql: data.TableName.Sanitize()})
+}
+
+func (l QueryLogger) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	start := started(ctx, "copy")
+	l.log(ctx, "copy", start.at, data.Err,
+		slog.String("table", start.sql),
+		slog.Int64("rows", data.CommandTag.RowsAffected()),
+	)
+}
+
+func (l QueryLogger) TraceTxStart(ctx context.Context) context.Context {
+	return context.WithValue(ctx, startKey{"tx"}, traceStart{at: time.Now()})
+}
+
+func (l QueryLogger) TraceTxEnd(ctx context.Context, err error) {
+	l.log(ctx, "transaction", started(ctx, "tx").at, err)
+}
+
+func (l QueryLogger) log(ctx context.Context, msg string, start time.Time, err error, attrs ...slog.Attr) {
+	level := l.options.Level
+	if !start.IsZero() {
+		duration := time.Since(start)
+		attrs = append(attrs, slog.Duration("duration", duration))
+		if l.options.SlowThreshold > 0 && duration >= l.options.SlowThreshold {
+			level = max(level, slog.LevelWarn)
+			attrs = append(attrs, slog.Bool("slow", true))
+		}
+	}
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (l QueryLogger) args(args []any) slog.Attr {
+	if !l.options.LogArgs {
+		return slog.Int("args", len(args))
+	}
+	if l.options.Redact != nil {
+		args = l.options.Redact(args)
+	}
+	return slog.Any("args", args)
+}
+
+func NewSpanTracer(tracer Tracer) SpanTracer {
+	return SpanTracer{tracer: tracer}
+}
+
+func (t SpanTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return t.start(ctx, "query", "db.query", slog.String("db.statement", data.SQL))
+}
+
+func (t SpanTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, "query", data.Err, slog.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+}
+
+func (t SpanTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return t.start(ctx, "batch", "db.batch", slog.Int("db.batch.size", data.Batch.Len()))
+}
+
+func (t SpanTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	if span, ok := ctx.Value(spanKey{"batch"}).(Span); ok && data.Err != nil {
+		span.RecordError(data.Err)
+	}
+}
+
+func (t SpanTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	t.end(ctx, "batch", data.Err)
+}
+
+func (t SpanTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	return t.start(ctx, "copy", "db.copy", slog.String("db.sql.table", data.TableName.Sanitize()))
+}
+
+func (t SpanTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, "copy", data.Err, slog.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+}
+
+func (t SpanTracer) TraceTxStart(ctx context.Context) context.Context {
+	return t.start(ctx, "tx", "db.transaction")
+}
+
+func (t SpanTracer) TraceTxEnd(ctx context.Context, err error) {
+	t.end(ctx, "tx", err)
+}
+
+func (t SpanTracer) start(ctx context.Context, kind, name string, attrs ...slog.Attr) context.Context {
+	ctx, span := t.tracer.Start(ctx, name, attrs...)
+	return context.WithValue(ctx, spanKey{kind}, span)
+}
+
+func (t SpanTracer) end(ctx context.Context, kind string, err error, attrs ...slog.Attr) {
+	span, ok := ctx.Value(spanKey{kind}).(Span)
+	if !ok {
+		return
+	}
+	if len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func started(ctx context.Context, kind string) traceStart {
+	start, _ := ctx.Value(startKey{kind}).(traceStart)
+	return start
+}
+
+func newTracer(tracers []pgx.QueryTracer) pgx.QueryTracer {
+	switch len(tracers) {
+	case 0:
+		return nil
+	case 1:
+		return tracers[0]
+	}
+	return multiTracer(tracers)
+}
+
+func (m multiTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	for _, t := range m {
+		ctx = t.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	for _, t := range m {
+		t.TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+func (m multiTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	for _, t := range m {
+		if t, ok := t.(pgx.BatchTracer); ok {
+			ctx = t.TraceBatchStart(ctx, conn, data)
+		}
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	for _, t := range m {
+		if t, ok := t.(pgx.BatchTracer); ok {
+			t.TraceBatchQuery(ctx, conn, data)
+		}
+	}
+}
+
+func (m multiTracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	for _, t := range m {
+		if t, ok := t.(pgx.BatchTracer); ok {
+			t.TraceBatchEnd(ctx, conn, data)
+		}
+	}
+}
+
+func (m multiTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	for _, t := range m {
+		if t, ok := t.(pgx.CopyFromTracer); ok {
+			ctx = t.TraceCopyFromStart(ctx, conn, data)
+		}
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	for _, t := range m {
+		if t, ok := t.(pgx.CopyFromTracer); ok {
+			t.TraceCopyFromEnd(ctx, conn, data)
+		}
+	}
+}
+
+func (m multiTracer) TraceTxStart(ctx context.Context) context.Context {
+	for _, t := range m {
+		if t, ok := t.(TxTracer); ok {
+			ctx = t.TraceTxStart(ctx)
+		}
+	}
+	return ctx
+}
+
+func (m multiTracer) TraceTxEnd(ctx context.Context, err error) {
+	for _, t := range m {
+		if t, ok := t.(TxTracer); ok {
+			t.TraceTxEnd(ctx, err)
+		}
+	}
+}
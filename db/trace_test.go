@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+type (
+	// captureHandler keeps every record logged through it.
+	captureHandler struct {
+		records *[]slog.Record
+	}
+
+	fakeTracer struct {
+		spans []*fakeSpan
+	}
+
+	fakeSpan struct {
+		name  string
+		attrs []slog.Attr
+		errs  []error
+		ended bool
+	}
+
+	// queryOnlyTracer implements pgx.QueryTracer and nothing else.
+	queryOnlyTracer struct {
+		queries *[]string
+	}
+)
+
+func (h captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h captureHandler) Handle(_ context.Context, r slog.Record) error {
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h captureHandler) WithGroup(string) slog.Handler { return h }
+
+func recordAttrs(r slog.Record) map[string]slog.Value {
+	attrs := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	return attrs
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	span := &fakeSpan{name: name, attrs: attrs}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func (s *fakeSpan) SetAttributes(attrs ...slog.Attr) {
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *fakeSpan) RecordError(err error) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *fakeSpan) End() {
+	s.ended = true
+}
+
+func (t queryOnlyTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	*t.queries = append(*t.queries, data.SQL)
+	return ctx
+}
+
+func (t queryOnlyTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+func TestQueryLogger(t *testing.T) {
+	var records []slog.Record
+	logger := slog.New(captureHandler{records: &records})
+	errQuery := errors.New("relation does not exist")
+
+	type testCase struct {
+		name    string
+		options LogOptions
+		err     error
+		level   slog.Level
+		args    any
+		slow    bool
+	}
+	for _, tc := range []testCase{
+		{name: "arg count", options: LogOptions{Level: slog.LevelDebug}, level: slog.LevelDebug, args: int64(2)},
+		{name: "args", options: LogOptions{LogArgs: true}, level: slog.LevelInfo, args: []any{1, "secret"}},
+		{
+			name: "redacted",
+			options: LogOptions{LogArgs: true, Redact: func(args []any) []any {
+				return []any{args[0], "***"}
+			}},
+			level: slog.LevelInfo,
+			args:  []any{1, "***"},
+		},
+		{name: "slow", options: LogOptions{SlowThreshold: time.Nanosecond}, level: slog.LevelWarn, args: int64(2), slow: true},
+		{name: "error", options: LogOptions{SlowThreshold: time.Nanosecond}, err: errQuery, level: slog.LevelError, args: int64(2), slow: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records = nil
+			l := NewQueryLogger(logger, tc.options)
+			ctx := l.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT $1, $2", Args: []any{1, "secret"}})
+			time.Sleep(time.Millisecond)
+			l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1"), Err: tc.err})
+			if len(records) != 1 {
+				t.Fatalf("logged %d records", len(records))
+			}
+			r := records[0]
+			attrs := recordAttrs(r)
+			if r.Level != tc.level || r.Message != "query" {
+				t.Errorf("record %s %q, want level %s", r.Level, r.Message, tc.level)
+			}
+			if attrs["sql"].String() != "SELECT $1, $2" || attrs["rows"].Int64() != 1 {
+				t.Errorf("attrs = %v", attrs)
+			}
+			switch want := tc.args.(type) {
+			case int64:
+				if attrs["args"].Int64() != want {
+					t.Errorf("args = %v", attrs["args"])
+				}
+			case []any:
+				if got, _ := attrs["args"].Any().([]any); !slices.Equal(got, want) {
+					t.Errorf("args = %v, want %v", attrs["args"], want)
+				}
+			}
+			if _, slow := attrs["slow"]; slow != tc.slow {
+				t.Errorf("slow = %t, want %t", slow, tc.slow)
+			}
+			if _, ok := attrs["duration"]; !ok {
+				t.Error("duration not logged")
+			}
+			if tc.err != nil && attrs["error"].String() != tc.err.Error() {
+				t.Errorf("error = %v", attrs["error"])
+			}
+		})
+	}
+}
+
+func TestQueryLoggerTx(t *testing.T) {
+	var records []slog.Record
+	l := NewQueryLogger(slog.New(captureHandler{records: &records}), LogOptions{})
+	errFn := errors.New("fn error")
+	err := RunInTransaction(context.Background(), PGX{tracer: l}.WithTx(&fakeTx{}), func(pgx.Tx) error {
+		return errFn
+	})
+	if !errors.Is(err, errFn) {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Message != "transaction" || records[0].Level != slog.LevelError {
+		t.Errorf("records = %v", records)
+	}
+}
+
+func TestSpanTracer(t *testing.T) {
+	tracer := &fakeTracer{}
+	st := NewSpanTracer(tracer)
+	ctx := context.Background()
+
+	queryCtx := st.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	st.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	errBatch := errors.New("batch query failed")
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1")
+	batchCtx := st.TraceBatchStart(ctx, nil, pgx.TraceBatchStartData{Batch: batch})
+	st.TraceBatchQuery(batchCtx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1", Err: errBatch})
+	st.TraceBatchEnd(batchCtx, nil, pgx.TraceBatchEndData{})
+
+	copyCtx := st.TraceCopyFromStart(ctx, nil, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"public", "items"}})
+	st.TraceCopyFromEnd(copyCtx, nil, pgx.TraceCopyFromEndData{CommandTag: pgconn.NewCommandTag("COPY 3")})
+
+	// A query ending without a started span is ignored.
+	st.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	names := make([]string, len(tracer.spans))
+	for i, span := range tracer.spans {
+		names[i] = span.name
+		if !span.ended {
+			t.Errorf("span %s not ended", span.name)
+		}
+	}
+	if !slices.Equal(names, []string{"db.query", "db.batch", "db.copy"}) {
+		t.Errorf("spans = %v", names)
+	}
+	query, batchSpan, copySpan := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	if query.attrs[0].Value.String() != "SELECT 1" || query.attrs[1].Value.Int64() != 1 {
+		t.Errorf("query attrs = %v", query.attrs)
+	}
+	if batchSpan.attrs[0].Value.Int64() != 1 || len(batchSpan.errs) != 1 || !errors.Is(batchSpan.errs[0], errBatch) {
+		t.Errorf("batch span = %+v", batchSpan)
+	}
+	if copySpan.attrs[0].Value.String() != `"public"."items"` || copySpan.attrs[1].Value.Int64() != 3 {
+		t.Errorf("copy attrs = %v", copySpan.attrs)
+	}
+}
+
+func TestSpanTracerTx(t *testing.T) {
+	tracer := &fakeTracer{}
+	root := &fakeTx{}
+	p := PGX{tracer: NewSpanTracer(tracer)}.WithTx(root)
+	err := p.RunInTransaction(context.Background(), func(pgx.Tx) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFn := errors.New("fn error")
+	err = p.RunInContext(context.Background(), func(ctx context.Context) error {
+		return p.RunInTransaction(ctx, func(pgx.Tx) error { return errFn })
+	})
+	if !errors.Is(err, errFn) {
+		t.Fatal(err)
+	}
+	if len(tracer.spans) != 3 {
+		t.Fatalf("started %d spans, want one per transaction", len(tracer.spans))
+	}
+	for i, span := range tracer.spans {
+		if span.name != "db.transaction" || !span.ended {
+			t.Errorf("span %d = %+v", i, span)
+		}
+	}
+	if len(tracer.spans[0].errs) != 0 || len(tracer.spans[1].errs) != 1 || len(tracer.spans[2].errs) != 1 {
+		t.Errorf("errors recorded: %v, %v, %v", tracer.spans[0].errs, tracer.spans[1].errs, tracer.spans[2].errs)
+	}
+}
+
+func TestMultiTracer(t *testing.T) {
+	if newTracer(nil) != nil {
+		t.Error("tracer without tracers")
+	}
+	var queries []string
+	only := queryOnlyTracer{queries: &queries}
+	if newTracer([]pgx.QueryTracer{only}) != pgx.QueryTracer(only) {
+		t.Error("single tracer wrapped")
+	}
+
+	spans := &fakeTracer{}
+	tracer := newTracer([]pgx.QueryTracer{only, NewSpanTracer(spans)}).(multiTracer)
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	ctx = tracer.TraceBatchStart(context.Background(), nil, pgx.TraceBatchStartData{Batch: &pgx.Batch{}})
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+	ctx = tracer.TraceTxStart(context.Background())
+	tracer.TraceTxEnd(ctx, nil)
+
+	if !slices.Equal(queries, []string{"SELECT 1"}) {
+		t.Errorf("queries = %v", queries)
+	}
+	if len(spans.spans) != 3 || spans.spans[1].name != "db.batch" || !spans.spans[2].ended {
+		t.Errorf("spans = %v", spans.spans)
+	}
+	if txTracer(PGX{tracer: tracer}) == nil || txTracer(fakeBeginner{}) != nil {
+		t.Error("transaction tracer not resolved from the beginner")
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"strings"
+	"sync"
+)
+
+// TypeRegistrar registers types in the type map of every new connection,
+// after decimal and uuid.
+type TypeRegistrar func(ctx context.Context, conn *pgx.Conn) error
+
+func WithTypeRegistrar(registrar TypeRegistrar) Option {
+	return func(o *options) {
+		o.types = append(o.types, registrar)
+	}
+}
+
+// WithTypes registers enum, composite, domain and range types by name, along
+// with their arrays and the types they depend on. Types are loaded by the
+// first connection and reused by the rest of the pool.
+func WithTypes(names ...string) Option {
+	var (
+		mu    sync.Mutex
+		types []*pgtype.Type
+	)
+	return WithTypeRegistrar(func(ctx context.Context, conn *pgx.Conn) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if types != nil {
+			conn.TypeMap().RegisterTypes(types)
+			return nil
+		}
+		loaded, err := conn.LoadTypes(ctx, withArrayNames(names))
+		if err != nil {
+			return fmt.Errorf("load types: %w", err)
+		}
+		if missing := missingTypes(names, loaded); len(missing) > 0 {
+			return fmt.Errorf("unknown types: %s", strings.Join(missing, ", "))
+		}
+		types = loaded
+		return nil
+	})
+}
+
+// WithCodec registers codec, and an array of it, for the type called name,
+// such as an extension type whose OID differs between databases.
+func WithCodec(name string, codec pgtype.Codec) Option {
+	var (
+		mu    sync.Mutex
+		types []*pgtype.Type
+	)
+	return WithTypeRegistrar(func(ctx context.Context, conn *pgx.Conn) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if types == nil {
+			var oid, arrayOID uint32
+			if err := conn.QueryRow(ctx,
+				"SELECT oid, typarray FROM pg_type WHERE oid = $1::text::regtype", name,
+			).Scan(&oid, &arrayOID); err != nil {
+				return fmt.Errorf("load type %q: %w", name, err)
+			}
+			t := &pgtype.Type{Name: name, OID: oid, Codec: codec}
+			types = []*pgtype.Type{t}
+			if arrayOID != 0 {
+				types = append(types, &pgtype.Type{Name: arrayName(name), OID: arrayOID, Codec: &pgtype.ArrayCodec{ElementType: t}})
+			}
+		}
+		conn.TypeMap().RegisterTypes(types)
+		return nil
+	})
+}
+
+func WithHstore() Option {
+	return WithCodec("hstore", pgtype.HstoreCodec{})
+}
+
+func WithLtree() Option {
+	return WithCodec("ltree", pgtype.LtreeCodec{})
+}
+
+func withArrayNames(names []string) []string {
+	r := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		r = append(r, name, arrayName(name))
+	}
+	return r
+}
+
+func arrayName(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i+1] + "_" + name[i+1:]
+	}
+	return "_" + name
+}
+
+func missingTypes(names []string, types []*pgtype.Type) []string {
+	loaded := make(map[string]bool, len(types))
+	for _, t := range types {
+		loaded[t.Name] = true
+	}
+	var missing []string
+	for _, name := range names {
+		if !loaded[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
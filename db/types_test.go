@@ -0,0 +1,21 @@
+package db
+
+import (
+	"github.com/jackc/pgx/v5/pgtype"
+	"slices"
+	"testing"
+)
+
+func TestWithArrayNames(t *testing.T) {
+	got := withArrayNames([]string{"mood", "app.address"})
+	if want := []string{"mood", "_mood", "app.address", "app._address"}; !slices.Equal(got, want) {
+		t.Errorf("withArrayNames = %v, want %v", got, want)
+	}
+}
+
+func TestMissingTypes(t *testing.T) {
+	loaded := []*pgtype.Type{{Name: "mood"}, {Name: "public.mood"}, {Name: "_mood"}}
+	if missing := missingTypes([]string{"mood", "public.mood", "address"}, loaded); !slices.Equal(missing, []string{"address"}) {
+		t.Errorf("missingTypes = %v", missing)
+	}
+}
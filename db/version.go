@@ -0,0 +1,45 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrPreconditionRequired = errors.New("precondition required")
+
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ParseETag returns the version of a strong entity tag. Weak tags are
+// rejected: If-Match compares strongly, so they never match.
+func ParseETag(tag string) (int64, error) {
+	tag = strings.TrimSpace(tag)
+	if strings.HasPrefix(tag, "W/") {
+		return 0, fmt.Errorf("etag %q: weak entity tag", tag)
+	}
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, fmt.Errorf("etag %q: %w", tag, err)
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("etag %q: %w", tag, err)
+	}
+	return version, nil
+}
+
+// IfMatch extracts the expected version from an If-Match header. Only a single
+// entity tag is accepted since an update targets exactly one version.
+func IfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, ErrPreconditionRequired
+	}
+	if strings.Contains(header, ",") {
+		return 0, fmt.Errorf("if-match %q: multiple entity tags", header)
+	}
+	return ParseETag(header)
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	type testCase struct {
+		header  string
+		version int64
+		err     bool
+	}
+	for _, tc := range []testCase{
+		{header: ETag(42), version: 42},
+		{header: `W/"7"`, err: true},
+		{header: `"x"`, err: true},
+		{header: `"1", "2"`, err: true},
+		{header: "*", err: true},
+	} {
+		version, err := IfMatch(tc.header)
+		if (err != nil) != tc.err || version != tc.version {
+			t.Errorf("IfMatch(%q) = %d, %v", tc.header, version, err)
+		}
+	}
+	if _, err := IfMatch(""); !errors.Is(err, ErrPreconditionRequired) {
+		t.Errorf("empty header: %v", err)
+	}
+}
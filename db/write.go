@@ -0,0 +1,255 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgconn"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	sqlDefault = squirrel.Expr("DEFAULT")
+
+	errNoConflict = errors.New("on conflict update: no conflict columns")
+)
+
+func InsertStruct[T any](table string, values ...T) (squirrel.InsertBuilder, error) {
+	return insertStruct(nil, table, values...)
+}
+
+func insertStruct[T any](scope Scope, table string, values ...T) (squirrel.InsertBuilder, error) {
+	fs, err := structFields[T]()
+	if err != nil {
+		return squirrel.InsertBuilder{}, err
+	}
+	if len(values) == 0 {
+		return squirrel.InsertBuilder{}, fmt.Errorf("%s: nothing to insert", table)
+	}
+	columns, rows := scope.values(insertRows(fs, reflectValues(values)))
+	builder := Postgres.Insert(table).Columns(columns...)
+	for _, row := range rows {
+		builder = builder.Values(row...)
+	}
+	return builder, nil
+}
+
+func UpsertStruct[T any](table string, conflict []string, values ...T) (squirrel.InsertBuilder, error) {
+	builder, err := InsertStruct(table, values...)
+	if err != nil {
+		return builder, err
+	}
+	fs, _ := structFields[T]()
+	columns, _ := insertRows(fs, reflectValues(values))
+	version, versioned := fs.version()
+	if !versioned {
+		return OnConflictUpdate(builder, conflict, columns...)
+	}
+	if len(conflict) == 0 {
+		return builder, errNoConflict
+	}
+	set := append(excluded(append(slices.Clone(conflict), version.name), columns), bumpVersion(table, version.name))
+	return builder.Suffix(onConflictUpdate(conflict, set)), nil
+}
+
+// OnConflictUpdate makes builder update columns other than the conflict
+// target from the proposed row, or do nothing when none are left.
+func OnConflictUpdate(builder squirrel.InsertBuilder, conflict []string, columns ...string) (squirrel.InsertBuilder, error) {
+	if len(conflict) == 0 {
+		return builder, errNoConflict
+	}
+	set := excluded(conflict, columns)
+	if len(set) == 0 {
+		return builder.Suffix(fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", strings.Join(conflict, ", "))), nil
+	}
+	return builder.Suffix(onConflictUpdate(conflict, set)), nil
+}
+
+func onConflictUpdate(conflict, set []string) string {
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflict, ", "), strings.Join(set, ", "))
+}
+
+func excluded(conflict, columns []string) []string {
+	set := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !slices.Contains(conflict, column) {
+			set = append(set, fmt.Sprintf("%[1]s = EXCLUDED.%[1]s", column))
+		}
+	}
+	return set
+}
+
+// bumpVersion increments the version of the conflicting row instead of taking
+// the proposed one, so that holders of the previous version see it as stale.
+// The column is qualified: EXCLUDED also has it.
+func bumpVersion(table, column string) string {
+	return fmt.Sprintf("%[2]s = %[1]s.%[2]s + 1", table, column)
+}
+
+func UpdateStruct[T any](table string, v T) (squirrel.UpdateBuilder, error) {
+	return updateStruct(nil, table, v)
+}
+
+// updateStruct leaves scope columns unchanged and restricts the update to
+// rows within the scope.
+func updateStruct[T any](scope Scope, table string, v T) (squirrel.UpdateBuilder, error) {
+	fs, err := structFields[T]()
+	if err != nil {
+		return squirrel.UpdateBuilder{}, err
+	}
+	pk, ok := fs.pk()
+	if !ok {
+		return squirrel.UpdateBuilder{}, fmt.Errorf("%s: no primary key field", table)
+	}
+	value := reflect.ValueOf(v)
+	builder := Postgres.Update(table)
+	var set bool
+	for _, f := range fs {
+		if f.pk || f.readonly || f.version || scope.scoped(f.name) {
+			continue
+		}
+		fieldValue := f.value(value)
+		if f.omitempty && fieldValue.IsZero() {
+			continue
+		}
+		builder = builder.Set(f.name, fieldValue.Interface())
+		set = true
+	}
+	if !set {
+		return squirrel.UpdateBuilder{}, fmt.Errorf("%s: nothing to update", table)
+	}
+	builder = builder.Where(squirrel.Eq{pk.name: pk.value(value).Interface()})
+	if len(scope) > 0 {
+		builder = builder.Where(scope.Where(table))
+	}
+	if version, ok := fs.version(); ok {
+		builder = withVersion(builder, version.name, version.value(value).Interface())
+	}
+	return builder, nil
+}
+
+func UpdateExec[T any](table string, v T) (ExecFunc[pgconn.CommandTag], error) {
+	if _, err := UpdateStruct(table, v); err != nil {
+		return nil, err
+	}
+	stale := staleError[T](table, v)
+	return func(ctx context.Context, executor Executor) (pgconn.CommandTag, error) {
+		builder, err := updateStruct(ScopeFrom(ctx), table, v)
+		if err != nil {
+			return pgconn.CommandTag{}, err
+		}
+		tag, err := Exec.WithBuilder(scoped(builder))(ctx, executor)
+		if err == nil && tag.RowsAffected() == 0 {
+			return tag, stale(nil)
+		}
+		return tag, err
+	}, nil
+}
+
+func InsertReturning[T any](table string, values ...T) (ExecFunc[[]T], error) {
+	if _, err := InsertStruct(table, values...); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, executor Executor) ([]T, error) {
+		builder, err := insertStruct(ScopeFrom(ctx), table, values...)
+		if err != nil {
+			return nil, err
+		}
+		return ExecWithScanner(GetRows.WithBuilder(scoped(builder.Suffix("RETURNING *"))), Scan[T])(ctx, executor)
+	}, nil
+}
+
+func UpdateReturning[T any](table string, v T) (ExecFunc[T], error) {
+	if _, err := UpdateStruct(table, v); err != nil {
+		return nil, err
+	}
+	stale := staleError[T](table, v)
+	return func(ctx context.Context, executor Executor) (T, error) {
+		builder, err := updateStruct(ScopeFrom(ctx), table, v)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		updated, err := ExecWithScanner(GetRows.WithBuilder(scoped(builder.Suffix("RETURNING *"))), ScanExactlyOne[T])(ctx, executor)
+		if errors.Is(err, ErrNotFound) {
+			return updated, stale(nil)
+		}
+		return updated, err
+	}, nil
+}
+
+func withVersion(builder squirrel.UpdateBuilder, column string, version any) squirrel.UpdateBuilder {
+	return builder.
+		Set(column, squirrel.Expr(column+" + 1")).
+		Where(squirrel.Eq{column: version})
+}
+
+// staleError reports a missing row as ErrStaleVersion when T is versioned:
+// the row exists under a newer version or was deleted concurrently.
+func staleError[T any](table string, v T) func(cause error) error {
+	fs, _ := structFields[T]()
+	version, versioned := fs.version()
+	return func(cause error) error {
+		if cause == nil {
+			cause = fmt.Errorf("update %s: no rows affected", table)
+		}
+		if !versioned {
+			return &Error{Kind: ErrNotFound, Table: table, Err: cause}
+		}
+		return &Error{
+			Kind:  ErrStaleVersion,
+			Table: table,
+			Err:   fmt.Errorf("version %v: %w", version.value(reflect.ValueOf(v)).Interface(), cause),
+		}
+	}
+}
+
+func insertRows(fs fields, values []reflect.Value) ([]string, [][]any) {
+	var columns []string
+	var written fields
+	for _, f := range fs {
+		if f.readonly {
+			continue
+		}
+		if (f.omitempty || f.pk) && allZero(f, values) {
+			continue
+		}
+		columns = append(columns, f.name)
+		written = append(written, f)
+	}
+
+	rows := make([][]any, 0, len(values))
+	for _, value := range values {
+		row := make([]any, 0, len(written))
+		for _, f := range written {
+			fieldValue := f.value(value)
+			if (f.omitempty || f.pk) && fieldValue.IsZero() {
+				row = append(row, sqlDefault)
+				continue
+			}
+			row = append(row, fieldValue.Interface())
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+func allZero(f field, values []reflect.Value) bool {
+	for _, value := range values {
+		if !f.value(value).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func reflectValues[T any](values []T) []reflect.Value {
+	r := make([]reflect.Value, 0, len(values))
+	for _, v := range values {
+		r = append(r, reflect.ValueOf(v))
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+type writeTestUser struct {
+	ID        int64     `db:"id,pk"`
+	Email     string    `db:"email"`
+	Name      string    `db:"name,omitempty"`
+	CreatedAt time.Time `db:"created_at,readonly"`
+	Ignored   string    `db:"-"`
+}
+
+func TestInsertStruct(t *testing.T) {
+	type testCase struct {
+		values []writeTestUser
+		sql    string
+		args   int
+	}
+	for _, tc := range []testCase{
+		{
+			values: []writeTestUser{{Email: "a@b.c"}},
+			sql:    "INSERT INTO users (email) VALUES ($1)",
+			args:   1,
+		},
+		{
+			values: []writeTestUser{{ID: 1, Email: "a@b.c", Name: "a"}},
+			sql:    "INSERT INTO users (id,email,name) VALUES ($1,$2,$3)",
+			args:   3,
+		},
+		{
+			values: []writeTestUser{{Email: "a@b.c", Name: "a"}, {Email: "d@e.f"}},
+			sql:    "INSERT INTO users (email,name) VALUES ($1,$2),($3,DEFAULT)",
+			args:   3,
+		},
+	} {
+		builder, err := InsertStruct("users", tc.values...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, args, err := builder.ToSql()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql != tc.sql || len(args) != tc.args {
+			t.Errorf("got %q %v, want %q with %d args", sql, args, tc.sql, tc.args)
+		}
+	}
+}
+
+func TestUpsertStruct(t *testing.T) {
+	builder, err := UpsertStruct("users", []string{"email"}, writeTestUser{Email: "a@b.c", Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _, err := builder.Suffix("RETURNING *").ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO users (email,name) VALUES ($1,$2) ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name RETURNING *"
+	if sql != want {
+		t.Errorf("got %q, want %q", sql, want)
+	}
+}
+
+func TestOnConflictUpdate(t *testing.T) {
+	builder := Postgres.Insert("tags").Columns("id").Values(1)
+	if _, err := OnConflictUpdate(builder, nil, "id", "name"); err == nil {
+		t.Error("empty conflict target accepted")
+	}
+	if _, err := UpsertStruct[writeTestUser]("users", nil, writeTestUser{Email: "a@b.c"}); err == nil {
+		t.Error("UpsertStruct accepted an empty conflict target")
+	}
+	nothing, err := OnConflictUpdate(builder, []string{"id"}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql, _, _ := nothing.ToSql(); sql != "INSERT INTO tags (id) VALUES ($1) ON CONFLICT (id) DO NOTHING" {
+		t.Errorf("got %q", sql)
+	}
+}
+
+func TestUpdateStruct(t *testing.T) {
+	builder, err := UpdateStruct("users", writeTestUser{ID: 1, Email: "a@b.c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "UPDATE users SET email = $1 WHERE id = $2"
+	if sql != want || !slices.Equal(args, []any{"a@b.c", int64(1)}) {
+		t.Errorf("got %q %v, want %q", sql, args, want)
+	}
+}
+
+type writeTestDocument struct {
+	ID      int64  `db:"id,pk"`
+	Title   string `db:"title"`
+	Version int64  `db:"version,version"`
+}
+
+func TestUpsertStructVersion(t *testing.T) {
+	builder, err := UpsertStruct("documents", []string{"id"}, writeTestDocument{ID: 1, Title: "draft", Version: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _, err := builder.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO documents (id,title,version) VALUES ($1,$2,$3) ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title, version = documents.version + 1"
+	if sql != want {
+		t.Errorf("got %q, want %q", sql, want)
+	}
+	if _, err = UpsertStruct[writeTestDocument]("documents", nil, writeTestDocument{ID: 1}); err == nil {
+		t.Error("empty conflict target accepted")
+	}
+}
+
+func TestUpdateStructVersion(t *testing.T) {
+	builder, err := UpdateStruct("documents", writeTestDocument{ID: 1, Title: "draft", Version: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "UPDATE documents SET title = $1, version = version + 1 WHERE id = $2 AND version = $3"
+	if sql != want || !slices.Equal(args, []any{"draft", int64(1), int64(3)}) {
+		t.Errorf("got %q %v, want %q", sql, args, want)
+	}
+}
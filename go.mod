@@ -1,6 +1,6 @@
 module github.com/bomjdev/yetanother
 
-go 1.22.2
+go 1.23
 
 require (
 	github.com/Masterminds/squirrel v1.5.4
@@ -80,7 +80,12 @@ func Delay(opt DelayOptions) Option {
 		return func(ctx context.Context) error {
 			err := fn(ctx)
 			if err != nil {
-				time.Sleep(delay)
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
 				if opt.Func != nil {
 					delay = opt.Func(delay)
 				}
@@ -93,6 +98,20 @@ func Delay(opt DelayOptions) Option {
 	}
 }
 
+func (opt DelayOptions) Attempt(n uint) time.Duration {
+	delay := opt.Delay
+	for i := uint(1); i < n && opt.Func != nil; i++ {
+		delay = opt.Func(delay)
+		if opt.Max != 0 && delay >= opt.Max {
+			break
+		}
+	}
+	if opt.Max != 0 {
+		delay = min(delay, opt.Max)
+	}
+	return delay
+}
+
 func Timeout(duration time.Duration) Option {
 	return func(fn Func) Func {
 		start := time.Now()
@@ -0,0 +1,49 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayOptionsAttempt(t *testing.T) {
+	type testCase struct {
+		options DelayOptions
+		attempt uint
+		want    time.Duration
+	}
+	for _, tc := range []testCase{
+		{options: DelayOptions{Delay: time.Second}, attempt: 1, want: time.Second},
+		{options: DelayOptions{Delay: time.Second}, attempt: 5, want: time.Second},
+		{options: DelayOptions{Delay: time.Second, Func: DoubleDelay}, attempt: 0, want: time.Second},
+		{options: DelayOptions{Delay: time.Second, Func: DoubleDelay}, attempt: 1, want: time.Second},
+		{options: DelayOptions{Delay: time.Second, Func: DoubleDelay}, attempt: 4, want: 8 * time.Second},
+		{options: DelayOptions{Delay: time.Second, Func: DoubleDelay, Max: 5 * time.Second}, attempt: 4, want: 5 * time.Second},
+		{options: DelayOptions{Delay: time.Second, Func: DoubleDelay, Max: 5 * time.Second}, attempt: 1000, want: 5 * time.Second},
+		{options: DelayOptions{Delay: 10 * time.Second, Max: 5 * time.Second}, attempt: 1, want: 5 * time.Second},
+	} {
+		if got := tc.options.Attempt(tc.attempt); got != tc.want {
+			t.Errorf("%+v attempt %d = %s, want %s", tc.options, tc.attempt, got, tc.want)
+		}
+	}
+}
+
+func TestDelayStopsOnContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	errFail := errors.New("fail")
+	start := time.Now()
+	err := New(Delay(DelayOptions{Delay: time.Hour}))(ctx, func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			return ErrStop
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) || !errors.Is(err, ErrStop) {
+		t.Errorf("err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("delay ignored the context for %s", elapsed)
+	}
+}